@@ -15,6 +15,8 @@ import (
 	"github.com/nextmn/ue-lite/internal/cli"
 	"github.com/nextmn/ue-lite/internal/radio"
 	"github.com/nextmn/ue-lite/internal/session"
+	"github.com/nextmn/ue-lite/internal/traffic"
+	"github.com/nextmn/ue-lite/internal/twamp"
 
 	"github.com/nextmn/json-api/healthcheck"
 	"github.com/nextmn/logrus-formatter/ginlogger"
@@ -28,11 +30,13 @@ type HttpServerEntity struct {
 	ps     *session.PduSessions
 	radio  *radio.Radio
 	cli    *cli.Cli
+	tg     *traffic.Generator
+	twamp  *twamp.Sender
 	closed chan struct{}
 }
 
-func NewHttpServerEntity(bindAddr netip.AddrPort, r *radio.Radio, ps *session.PduSessions) *HttpServerEntity {
-	c := cli.NewCli(r, ps)
+func NewHttpServerEntity(bindAddr netip.AddrPort, r *radio.Radio, ps *session.PduSessions, tg *traffic.Generator, tw *twamp.Sender, exec bool) *HttpServerEntity {
+	c := cli.NewCli(r, ps, exec)
 	gin.SetMode(gin.ReleaseMode)
 	h := ginlogger.Default()
 	h.GET("/status", Status)
@@ -46,6 +50,12 @@ func NewHttpServerEntity(bindAddr netip.AddrPort, r *radio.Radio, ps *session.Pd
 	// Pdu Session
 	ps.Register(h)
 
+	// Traffic Generator
+	tg.Register(h)
+
+	// TWAMP-Light Sender
+	tw.Register(h)
+
 	logrus.WithFields(logrus.Fields{"http-addr": bindAddr}).Info("HTTP Server created")
 	e := HttpServerEntity{
 		srv: &http.Server{
@@ -55,6 +65,8 @@ func NewHttpServerEntity(bindAddr netip.AddrPort, r *radio.Radio, ps *session.Pd
 		ps:     ps,
 		radio:  r,
 		cli:    c,
+		tg:     tg,
+		twamp:  tw,
 		closed: make(chan struct{}),
 	}
 	return &e
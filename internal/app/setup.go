@@ -12,7 +12,9 @@ import (
 	"github.com/nextmn/ue-lite/internal/config"
 	"github.com/nextmn/ue-lite/internal/radio"
 	"github.com/nextmn/ue-lite/internal/session"
+	"github.com/nextmn/ue-lite/internal/traffic"
 	"github.com/nextmn/ue-lite/internal/tun"
+	"github.com/nextmn/ue-lite/internal/twamp"
 
 	"github.com/sirupsen/logrus"
 )
@@ -22,23 +24,41 @@ type Setup struct {
 	httpServerEntity *HttpServerEntity
 	radioDaemon      *radio.RadioDaemon
 	ps               *session.PduSessions
+	tg               *traffic.Generator
+	twamp            *twamp.Sender
 	tunMan           *tun.TunManager
 }
 
 func NewSetup(config *config.UEConfig) *Setup {
-	tunMan := tun.NewTunManager()
-	r := radio.NewRadio(config.Control.Uri, tunMan, config.Ran.OneWayDelays.Data, config.Ran.BindAddr, "go-github-nextmn-ue-lite")
-	ps := session.NewPduSessions(config.Control.Uri, r, config.Ran.OneWayDelays.Control, config.Ran.PDUSessions, "go-github-nextmn-ue-lite")
+	ethernet := false
+	for _, ps := range config.Ran.PDUSessions {
+		if ps.IsEthernet() {
+			ethernet = true
+		}
+	}
+	tunMan := tun.NewTunManager(ethernet, config.Ran.Workers, config.Tun)
+	r := radio.NewRadio(config.Control.Uri, tunMan, config.Ran.OneWayDelays.Data, config.Ran.DownlinkOneWayDelays.Data, config.Ran.BindAddr, config.Ran.Impairments, config.Ran.Seed, config.Ran.Workers, "go-github-nextmn-ue-lite")
+	ps := session.NewPduSessions(config.Control.Uri, r, config.Ran.OneWayDelays.Control, config.Ran.DownlinkOneWayDelays.Control, config.Ran.PDUSessions, "go-github-nextmn-ue-lite")
+	tg := traffic.NewGenerator(ps, tunMan)
+	tw := twamp.NewSender(ps, tunMan)
 	return &Setup{
 		config:           config,
-		httpServerEntity: NewHttpServerEntity(config.Control.BindAddr, r, ps),
+		httpServerEntity: NewHttpServerEntity(config.Control.BindAddr, r, ps, tg, tw, config.Control.Exec),
 		radioDaemon:      radio.NewRadioDaemon(config.Control.Uri, config.Ran.Gnbs, r, config.Ran.BindAddr),
 		ps:               ps,
+		tg:               tg,
+		twamp:            tw,
 		tunMan:           tunMan,
 	}
 }
 
 func (s *Setup) waitShutdown(ctx context.Context) {
+	if s.twamp != nil {
+		s.twamp.WaitShutdown(ctx)
+	}
+	if s.tg != nil {
+		s.tg.WaitShutdown(ctx)
+	}
 	if s.ps != nil {
 		s.ps.WaitShutdown(ctx)
 	}
@@ -79,6 +99,16 @@ func (s *Setup) Run(ctx context.Context) error {
 	}
 	logrus.Debug("PsMan started")
 
+	if err := s.tg.Start(ctx); err != nil {
+		return err
+	}
+	logrus.Debug("Traffic Generator started")
+
+	if err := s.twamp.Start(ctx); err != nil {
+		return err
+	}
+	logrus.Debug("TWAMP-Light Sender started")
+
 	<-ctx.Done()
 	return nil
 }
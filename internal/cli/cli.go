@@ -17,12 +17,14 @@ import (
 type Cli struct {
 	Radio       *radio.Radio
 	PduSessions *session.PduSessions
+	exec        bool // commands can be executed in PDU Sessions
 }
 
-func NewCli(radio *radio.Radio, pduSessions *session.PduSessions) *Cli {
+func NewCli(radio *radio.Radio, pduSessions *session.PduSessions, exec bool) *Cli {
 	return &Cli{
 		Radio:       radio,
 		PduSessions: pduSessions,
+		exec:        exec,
 	}
 }
 
@@ -34,4 +36,6 @@ type CliPeerMsg struct {
 func (cli *Cli) Register(e *gin.Engine) {
 	e.POST("/cli/radio/peer", cli.RadioPeer)
 	e.POST("/cli/ps/establish", cli.PsEstablish)
+	e.POST("/cli/ps/ambr", cli.PsAmbr)
+	e.POST("/cli/ps/exec", cli.PsExec)
 }
@@ -0,0 +1,31 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrExecDisabled    = errors.New("execution of commands is disabled: set `control.exec: true` to enable it")
+	ErrEmptyCommand    = errors.New("empty command")
+	ErrMissingExitCode = errors.New("the exit code of the command is missing (interrupted?)")
+)
+
+// ExecError is returned when the UE refuses to execute a command
+type ExecError struct {
+	Status string
+	Err    error
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Status, e.Err)
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
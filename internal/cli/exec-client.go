@@ -0,0 +1,53 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/nextmn/json-api/jsonapi"
+)
+
+// Exec executes a command in a PDU Session of the UE controlled with this URI, and copies its output to w.
+// It returns the exit code of the command.
+func Exec(ctx context.Context, control jsonapi.ControlURI, msg CliExecMsg, w io.Writer, userAgent string) (int, error) {
+	reqBody, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, control.JoinPath("cli/ps/exec").String(), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e jsonapi.MessageWithError
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+			return 0, &ExecError{Status: resp.Status, Err: err}
+		}
+		return 0, &ExecError{Status: resp.Status, Err: e.Error}
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return 0, err
+	}
+	// trailers are available once the body has been read
+	code, err := strconv.Atoi(resp.Trailer.Get(EXEC_EXIT_CODE_TRAILER))
+	if err != nil {
+		return 0, ErrMissingExitCode
+	}
+	return code, nil
+}
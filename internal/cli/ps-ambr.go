@@ -0,0 +1,52 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package cli
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+
+	"github.com/nextmn/ue-lite/internal/config"
+	"github.com/nextmn/ue-lite/internal/radio"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type CliAmbrMsg struct {
+	Addr netip.Addr `json:"address"` // UE IP Address of the PDU Session
+	config.Ambr
+}
+
+// Change the Session-AMBR of a PDU Session
+func (cli *Cli) PsAmbr(c *gin.Context) {
+	var msg CliAmbrMsg
+	if err := c.BindJSON(&msg); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	if err := cli.Radio.SetAmbr(msg.Addr, msg.Ambr); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"ue-ip-addr": msg.Addr,
+		}).Error("Could not set Session-AMBR")
+		status := http.StatusInternalServerError
+		if errors.Is(err, radio.ErrPduSessionNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, jsonapi.MessageWithError{Message: "could not set Session-AMBR", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue-ip-addr":    msg.Addr,
+		"ambr-uplink":   msg.Uplink,
+		"ambr-downlink": msg.Downlink,
+	}).Info("Session-AMBR updated")
+	c.JSON(http.StatusOK, msg)
+}
@@ -0,0 +1,122 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package cli
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/nextmn/ue-lite/internal/tun"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Placeholder replaced by the UE IP Address in arguments of the command
+	EXEC_UE_IP_ADDR_PLACEHOLDER = "{ue-ip-addr}"
+
+	// Trailer containing the exit code of the command
+	EXEC_EXIT_CODE_TRAILER = "Exit-Code"
+
+	// Header containing the UE IP Address of the PDU Session
+	EXEC_UE_IP_ADDR_HEADER = "Ue-Ip-Addr"
+)
+
+type CliExecMsg struct {
+	Dnn     string     `json:"dnn,omitempty"`     // DNN of the PDU Session
+	Addr    netip.Addr `json:"address,omitempty"` // UE IP Address of the PDU Session (instead of the DNN)
+	Command []string   `json:"command"`           // command and its arguments
+}
+
+// flushWriter flushes the response after each write, to stream the output of the command
+type flushWriter struct {
+	w gin.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.w.Flush()
+	return n, err
+}
+
+// Execute a command in the network namespace of a PDU Session, and stream its output (stdout and stderr).
+// Without a network namespace, the command runs on the host and must bind to the UE IP Address to use the PDU Session.
+// The UE IP Address is available in the UE_IP_ADDR environment variable, and replaces `{ue-ip-addr}` in arguments.
+// The exit code of the command is sent in the `Exit-Code` trailer.
+func (cli *Cli) PsExec(c *gin.Context) {
+	if !cli.exec {
+		c.JSON(http.StatusForbidden, jsonapi.MessageWithError{Message: "could not execute command", Error: ErrExecDisabled})
+		return
+	}
+	var msg CliExecMsg
+	if err := c.BindJSON(&msg); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	if len(msg.Command) == 0 {
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not execute command", Error: ErrEmptyCommand})
+		return
+	}
+	ip, dnn, err := cli.PduSessions.Lookup(msg.Dnn, msg.Addr)
+	if err != nil {
+		c.JSON(http.StatusNotFound, jsonapi.MessageWithError{Message: "could not execute command", Error: err})
+		return
+	}
+
+	args := make([]string, len(msg.Command))
+	for i, arg := range msg.Command {
+		args[i] = strings.ReplaceAll(arg, EXEC_UE_IP_ADDR_PLACEHOLDER, ip.String())
+	}
+	cmd := exec.CommandContext(c.Request.Context(), args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "UE_IP_ADDR="+ip.String(), "UE_DNN="+dnn)
+	out := flushWriter{w: c.Writer}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	c.Header("Trailer", EXEC_EXIT_CODE_TRAILER)
+	c.Header(EXEC_UE_IP_ADDR_HEADER, ip.String())
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Cache-Control", "no-cache")
+	if err := cli.Radio.Tun.StartCommand(cmd, ip); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"ue-ip-addr": ip,
+			"command":    args,
+		}).Error("Could not execute command")
+		status := http.StatusInternalServerError
+		if errors.Is(err, tun.ErrUserspaceExec) {
+			status = http.StatusNotImplemented
+		} else if errors.Is(err, tun.ErrNoSessionRouting) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, jsonapi.MessageWithError{Message: "could not execute command", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue-ip-addr": ip,
+		"command":    args,
+	}).Info("Command started")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	err = cmd.Wait()
+	code := cmd.ProcessState.ExitCode()
+	c.Writer.Header().Set(EXEC_EXIT_CODE_TRAILER, strconv.Itoa(code))
+	logrus.WithError(err).WithFields(logrus.Fields{
+		"ue-ip-addr": ip,
+		"command":    args,
+		"exit-code":  code,
+	}).Info("Command exited")
+}
@@ -0,0 +1,54 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package common
+
+import (
+	"errors"
+	"net"
+)
+
+var ErrInvalidMacAddr = errors.New("invalid EUI-48 MAC address")
+
+// MacAddr is a comparable EUI-48 MAC address, usable as a map key.
+type MacAddr [6]byte
+
+// MacAddrFromSlice parses a 6 bytes slice (e.g. from an Ethernet header) as a MacAddr.
+func MacAddrFromSlice(s []byte) (MacAddr, bool) {
+	if len(s) != 6 {
+		return MacAddr{}, false
+	}
+	return MacAddr(s), true
+}
+
+// ParseMacAddr parses s as an EUI-48 MAC address, using one of the formats accepted by [net.ParseMAC].
+func ParseMacAddr(s string) (MacAddr, error) {
+	hw, err := net.ParseMAC(s)
+	if err != nil {
+		return MacAddr{}, err
+	}
+	m, ok := MacAddrFromSlice(hw)
+	if !ok {
+		return MacAddr{}, ErrInvalidMacAddr
+	}
+	return m, nil
+}
+
+func (m MacAddr) String() string {
+	return net.HardwareAddr(m[:]).String()
+}
+
+func (m MacAddr) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *MacAddr) UnmarshalText(text []byte) error {
+	p, err := ParseMacAddr(string(text))
+	if err != nil {
+		return err
+	}
+	*m = p
+	return nil
+}
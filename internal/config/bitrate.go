@@ -0,0 +1,68 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidBitrate = errors.New("invalid bitrate")
+
+// Bitrate in bit/s. It can be written as `100000`, `100kbps`, `10Mbps`, `1Gbps`, etc. (SI prefixes).
+// A zero Bitrate means no limit.
+type Bitrate uint64
+
+var bitratePrefixes = []struct {
+	prefix string
+	mult   float64
+}{
+	{"k", 1e3},
+	{"m", 1e6},
+	{"g", 1e9},
+	{"t", 1e12},
+}
+
+func ParseBitrate(s string) (Bitrate, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	for _, unit := range []string{"bps", "bit/s", "b/s"} {
+		if strings.HasSuffix(v, unit) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, unit))
+			break
+		}
+	}
+	mult := 1.0
+	for _, p := range bitratePrefixes {
+		if strings.HasSuffix(v, p.prefix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, p.prefix))
+			mult = p.mult
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, ErrInvalidBitrate
+	}
+	return Bitrate(f * mult), nil
+}
+
+func (b Bitrate) String() string {
+	return strconv.FormatUint(uint64(b), 10) + "bps"
+}
+
+func (b Bitrate) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *Bitrate) UnmarshalText(text []byte) error {
+	p, err := ParseBitrate(string(text))
+	if err != nil {
+		return err
+	}
+	*b = p
+	return nil
+}
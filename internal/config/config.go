@@ -10,8 +10,11 @@ import (
 	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
+	"github.com/nextmn/ue-lite/internal/common"
+
 	"github.com/nextmn/json-api/jsonapi"
 
 	"go.yaml.in/yaml/v3"
@@ -49,12 +52,40 @@ func ParseConf(file string) (*UEConfig, error) {
 type UEConfig struct {
 	Control Control `yaml:"control"`
 	Ran     Ran     `yaml:"ran"`
+	Tun     Tun     `yaml:"tun,omitempty"`
 	Logger  *Logger `yaml:"logger,omitempty"`
 }
 
+type FirewallBackend string
+
+const (
+	FirewallBackendAuto           FirewallBackend = "auto"
+	FirewallBackendIptablesLegacy FirewallBackend = "iptables-legacy"
+	FirewallBackendIptablesNft    FirewallBackend = "iptables-nft"
+	FirewallBackendNftables       FirewallBackend = "nftables"
+)
+
+type Tun struct {
+	// identifier of this instance, used to tag the routing tables, rules and firewall table it creates,
+	// so several instances can run on the same host (default: 0)
+	Instance uint16 `yaml:"instance,omitempty"`
+	Name     string `yaml:"name,omitempty"`     // name of the TUN interface (default: nextmn-ue-lite, or nextmn-ue<instance>)
+	TapName  string `yaml:"tap-name,omitempty"` // name of the TAP interface used by Ethernet PDU Sessions (default: nextmn-ue-eth, or nextmn-eth<instance>)
+	Mtu      int    `yaml:"mtu,omitempty"`      // MTU of the TUN/TAP interfaces (default: 1400)
+
+	Firewall         FirewallBackend `yaml:"firewall,omitempty"`           // firewall backend (default: auto)
+	KeepDefaultRoute bool            `yaml:"keep-default-route,omitempty"` // do not replace the default routes of the host: only traffic from UE IP Addresses uses PDU Sessions
+	Netns            string          `yaml:"netns,omitempty"`              // create the TUN interface in this network namespace (created if it does not exist)
+
+	// use an in-process TCP/IP stack instead of a kernel TUN interface (neither NET_ADMIN nor /dev/net/tun are required);
+	// PDU Sessions are then only reachable through their `forwards`
+	Userspace bool `yaml:"userspace,omitempty"`
+}
+
 type Control struct {
-	Uri      jsonapi.ControlURI `yaml:"uri"`       // may contain domain name instead of ip address
-	BindAddr netip.AddrPort     `yaml:"bind-addr"` // in the form `ip:port`
+	Uri      jsonapi.ControlURI `yaml:"uri"`            // may contain domain name instead of ip address
+	BindAddr netip.AddrPort     `yaml:"bind-addr"`      // in the form `ip:port`
+	Exec     bool               `yaml:"exec,omitempty"` // allow commands to be executed in PDU Sessions with `POST /cli/ps/exec`
 }
 
 type OneWayDelays struct {
@@ -63,13 +94,168 @@ type OneWayDelays struct {
 }
 
 type Ran struct {
-	BindAddr     netip.AddrPort       `yaml:"bind-addr"`      // in the form ip:port
-	OneWayDelays OneWayDelays         `yaml:"one-way-delays"` // one-way-delays used for uplink
-	Gnbs         []jsonapi.ControlURI `yaml:"gnbs"`           // list of gnb used
-	PDUSessions  []PDUSession         `yaml:"pdu-sessions"`   // list of pdu sessions that will be established
+	BindAddr             netip.AddrPort       `yaml:"bind-addr"`                         // in the form ip:port
+	OneWayDelays         OneWayDelays         `yaml:"one-way-delays"`                    // one-way-delays used for uplink
+	DownlinkOneWayDelays OneWayDelays         `yaml:"downlink-one-way-delays,omitempty"` // one-way-delays used for downlink
+	Gnbs                 []jsonapi.ControlURI `yaml:"gnbs"`                              // list of gnb used
+	PDUSessions          []PDUSession         `yaml:"pdu-sessions"`                      // list of pdu sessions that will be established
+	Impairments          []Impairments        `yaml:"impairments,omitempty"`             // radio channel impairments, per gNB
+	Seed                 *uint64              `yaml:"seed,omitempty"`                    // seed used for impairments (default: random)
+	Workers              int                  `yaml:"workers,omitempty"`                 // number of data path workers, TUN queues and radio socket readers (default: 1)
 }
 
+type PDUSessionType string
+
+const (
+	PDUSessionTypeIPv4     PDUSessionType = "ipv4"
+	PDUSessionTypeIPv6     PDUSessionType = "ipv6"
+	PDUSessionTypeIPv4v6   PDUSessionType = "ipv4v6" // an IPv4 and an IPv6 UE IP Addresses are attributed
+	PDUSessionTypeEthernet PDUSessionType = "ethernet"
+)
+
 type PDUSession struct {
-	Gnb jsonapi.ControlURI `yaml:"gnb"`
-	Dnn string             `yaml:"dnn"`
+	Gnb  jsonapi.ControlURI `yaml:"gnb"`
+	Dnn  string             `yaml:"dnn"`
+	Type PDUSessionType     `yaml:"type,omitempty"` // ipv4, ipv6, ipv4v6 or ethernet (default: IP, with the address families chosen by the CP)
+	Macs []common.MacAddr   `yaml:"macs,omitempty"` // ethernet only: source MAC addresses using this session (default: MAC of the TAP interface)
+	Ambr Ambr               `yaml:"ambr,omitempty"` // Session-AMBR enforced by the UE (default: no limit)
+
+	// IP only: destinations routed through this PDU Session (split tunnelling);
+	// routes of the host to the same destinations (e.g. its default route, with `keep-default-route`) are preferred
+	Routes  []netip.Prefix `yaml:"routes,omitempty"`
+	Default bool           `yaml:"default,omitempty"` // route the default destination through this PDU Session
+
+	// IP only: network namespace created for this PDU Session, with the UE IP Address and a default route (routes are not used)
+	Netns string `yaml:"netns,omitempty"`
+
+	// IP only: local proxies to the Data Network, using the UE IP Address as source
+	Forwards []Forward `yaml:"forwards,omitempty"`
+	// IP only: listen address of a SOCKS5 server whose outgoing connections use the UE IP Address as source
+	Socks5 netip.AddrPort `yaml:"socks5,omitempty"`
+	// IP only: DNS server in the Data Network, queried through this PDU Session to resolve domain names requested to the SOCKS5 server
+	// (default: domain names are refused)
+	Socks5Dns netip.Addr `yaml:"socks5-dns,omitempty"`
+
+	// IP only: latency probe sent continuously over this PDU Session, to measure handover interruptions
+	Probe *Probe `yaml:"probe,omitempty"`
+}
+
+type ProbeProtocol string
+
+const (
+	ProbeProtocolUdp  ProbeProtocol = "udp"
+	ProbeProtocolIcmp ProbeProtocol = "icmp"
+)
+
+// Probe sends sequence-numbered, timestamped packets to an echo target in the Data Network
+type Probe struct {
+	Protocol ProbeProtocol `yaml:"protocol"`           // udp (the target must echo datagrams back) or icmp (echo requests)
+	Target   string        `yaml:"target"`             // udp: `ip:port`; icmp: `ip`
+	Interval time.Duration `yaml:"interval,omitempty"` // interval between packets, from 1ms to 2*window+timeout (default: 10ms)
+	Size     int           `yaml:"size,omitempty"`     // size of packets, IP header included (default: 64)
+	Timeout  time.Duration `yaml:"timeout,omitempty"`  // packets not answered after this delay are lost (default: 1s)
+	Window   time.Duration `yaml:"window,omitempty"`   // packets sent this long before and after a handover are used to measure it (default: 1s)
+}
+
+type ForwardProtocol string
+
+const (
+	ForwardProtocolTcp ForwardProtocol = "tcp"
+	ForwardProtocolUdp ForwardProtocol = "udp"
+)
+
+// Forward relays connections accepted on a local address to a target in the Data Network
+type Forward struct {
+	Protocol ForwardProtocol `yaml:"protocol" json:"protocol"` // tcp or udp
+	Listen   netip.AddrPort  `yaml:"listen" json:"listen"`     // local address, in the form `ip:port`
+	Target   netip.AddrPort  `yaml:"target" json:"target"`     // address in the Data Network, in the form `ip:port`
+}
+
+// Destinations returns the destinations routed through this PDU Session, for this UE IP Address
+func (ps PDUSession) Destinations(ueIp netip.Addr) []netip.Prefix {
+	dsts := ps.Routes
+	if ps.Default {
+		def := netip.PrefixFrom(netip.IPv4Unspecified(), 0)
+		if ueIp.Unmap().Is6() {
+			def = netip.PrefixFrom(netip.IPv6Unspecified(), 0)
+		}
+		dsts = append(slices.Clone(dsts), def)
+	}
+	return dsts
+}
+
+// Session-AMBR; a zero Bitrate means no limit
+type Ambr struct {
+	Uplink   Bitrate `yaml:"uplink,omitempty" json:"uplink"`
+	Downlink Bitrate `yaml:"downlink,omitempty" json:"downlink"`
+}
+
+// IsEthernet returns true if the PDU Session is an Ethernet PDU Session
+func (ps PDUSession) IsEthernet() bool {
+	return ps.Type == PDUSessionTypeEthernet
+}
+
+type Impairments struct {
+	Gnb      jsonapi.ControlURI `yaml:"gnb"`
+	Uplink   Impairment         `yaml:"uplink,omitempty"`
+	Downlink Impairment         `yaml:"downlink,omitempty"`
+}
+
+type Impairment struct {
+	Trace       *Trace  `yaml:"trace,omitempty"` // schedules data PDUs
+	Loss        *Loss   `yaml:"loss,omitempty"`
+	Jitter      *Jitter `yaml:"jitter,omitempty"`
+	Duplication float64 `yaml:"duplication,omitempty"` // probability for a PDU to be sent twice
+	Reordering  float64 `yaml:"reordering,omitempty"`  // probability for a PDU to be sent without delay, overtaking PDUs already delayed
+}
+
+type LossModel string
+
+const (
+	LossModelRandom         LossModel = "random"
+	LossModelGilbertElliott LossModel = "gilbert-elliott"
+)
+
+type Loss struct {
+	Model LossModel `yaml:"model"`
+
+	// random
+	Probability float64 `yaml:"probability,omitempty"`
+
+	// gilbert-elliott
+	P        float64  `yaml:"p,omitempty"`         // transition probability from good to bad state
+	R        float64  `yaml:"r,omitempty"`         // transition probability from bad to good state
+	LossGood float64  `yaml:"loss-good,omitempty"` // loss probability in good state (1-k)
+	LossBad  *float64 `yaml:"loss-bad,omitempty"`  // loss probability in bad state (1-h), default: 1
+}
+
+type JitterDistribution string
+
+const (
+	JitterDistributionUniform     JitterDistribution = "uniform"
+	JitterDistributionNormal      JitterDistribution = "normal"
+	JitterDistributionExponential JitterDistribution = "exponential"
+)
+
+type Jitter struct {
+	Distribution JitterDistribution `yaml:"distribution"`
+	Value        time.Duration      `yaml:"value"` // uniform: maximum deviation; normal: standard deviation; exponential: mean
+}
+
+type TraceFormat string
+
+const (
+	// Mahimahi trace: one line per delivery opportunity of 1504 bytes, with its timestamp in milliseconds.
+	// The one-way delay is added after the delivery opportunity.
+	TraceFormatMahimahi TraceFormat = "mahimahi"
+	// One line per step, `<timestamp-ms> <one-way-delay-ms> <bandwidth-kbps>`.
+	// Values apply until the next line; the last line marks the end of the trace.
+	// A bandwidth of 0 means the link is interrupted.
+	TraceFormatDelayBandwidth TraceFormat = "delay-bandwidth"
+)
+
+// Trace files are replayed in a loop
+type Trace struct {
+	Format TraceFormat `yaml:"format"`
+	File   string      `yaml:"file"`
 }
@@ -0,0 +1,84 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/tun"
+
+	"github.com/nextmn/json-api/jsonapi"
+)
+
+// Timeout of requests sent to gNBs
+const GNB_TIMEOUT = 2 * time.Second
+
+func checkTunDevice(ctx context.Context) (string, error) {
+	f, err := os.OpenFile(TUN_DEVICE, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return TUN_DEVICE, nil
+}
+
+func checkNetlink(ctx context.Context) (string, error) {
+	if err := tun.CheckNetlink(); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+func (d *Doctor) checkFirewall(ctx context.Context) (string, error) {
+	fw, err := tun.NewFirewall(d.conf.Tun.Firewall, tun.FIREWALL_TABLE_NAME)
+	if err != nil {
+		return "", err
+	}
+	return string(fw.Backend()), nil
+}
+
+func (d *Doctor) checkRanBindAddr(ctx context.Context) (string, error) {
+	conn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(d.conf.Ran.BindAddr))
+	if err != nil {
+		return "", err
+	}
+	conn.Close()
+	return d.conf.Ran.BindAddr.String(), nil
+}
+
+func (d *Doctor) checkControlBindAddr(ctx context.Context) (string, error) {
+	l, err := net.Listen("tcp", d.conf.Control.BindAddr.String())
+	if err != nil {
+		return "", err
+	}
+	l.Close()
+	return d.conf.Control.BindAddr.String(), nil
+}
+
+func (d *Doctor) checkGnb(ctx context.Context, gnb jsonapi.ControlURI) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, GNB_TIMEOUT)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gnb.JoinPath("status").String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", d.userAgent)
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return "reachable", nil
+}
@@ -0,0 +1,48 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+
+package doctor
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const TUN_DEVICE = "/dev/net/tun"
+
+// checkNetAdmin checks the effective capabilities of the process
+func checkNetAdmin(ctx context.Context) (string, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		v, ok := strings.CutPrefix(scanner.Text(), "CapEff:")
+		if !ok {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+		if err != nil {
+			return "", err
+		}
+		if caps&(1<<unix.CAP_NET_ADMIN) == 0 {
+			return "", ErrMissingNetAdmin
+		}
+		return "", nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", ErrUnknownCapabilities
+}
@@ -0,0 +1,18 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+
+package doctor
+
+import (
+	"context"
+)
+
+const TUN_DEVICE = "/dev/tun0"
+
+func checkNetAdmin(ctx context.Context) (string, error) {
+	return "", ErrUnknownCapabilities
+}
@@ -0,0 +1,147 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/nextmn/ue-lite/internal/config"
+	"github.com/nextmn/ue-lite/internal/tun"
+)
+
+// check is a preflight check; a failed check comes with a hint to fix it
+type check struct {
+	name string
+	run  func(ctx context.Context) (detail string, err error)
+	fix  string
+}
+
+// Doctor checks the host is ready to run the UE with this configuration
+type Doctor struct {
+	conf      *config.UEConfig
+	userAgent string
+}
+
+func NewDoctor(conf *config.UEConfig, userAgent string) *Doctor {
+	return &Doctor{
+		conf:      conf,
+		userAgent: userAgent,
+	}
+}
+
+// Run runs all checks and prints a report to w; it returns false if a check failed
+func (d *Doctor) Run(ctx context.Context, w io.Writer) bool {
+	ok := true
+	for _, c := range d.checks() {
+		detail, err := c.run(ctx)
+		if err != nil {
+			ok = false
+			fmt.Fprintf(w, "[FAIL] %s: %s\n", c.name, err)
+			fmt.Fprintf(w, "       fix: %s\n", c.fix)
+			continue
+		}
+		if detail != "" {
+			fmt.Fprintf(w, "[PASS] %s: %s\n", c.name, detail)
+		} else {
+			fmt.Fprintf(w, "[PASS] %s\n", c.name)
+		}
+	}
+	return ok
+}
+
+func (d *Doctor) checks() []check {
+	var checks []check
+	if !d.conf.Tun.Userspace {
+		// the userspace network stack does not use the kernel
+		checks = append(checks, d.kernelChecks()...)
+	}
+	checks = append(checks, []check{
+		{
+			name: "ran.bind-addr",
+			run:  d.checkRanBindAddr,
+			fix:  "use an address configured on this host, with a port not used by another process",
+		},
+		{
+			name: "control.bind-addr",
+			run:  d.checkControlBindAddr,
+			fix:  "use an address configured on this host, with a port not used by another process",
+		},
+	}...)
+	for _, gnb := range d.conf.Ran.Gnbs {
+		checks = append(checks, check{
+			name: "gNB " + gnb.String(),
+			run: func(ctx context.Context) (string, error) {
+				return d.checkGnb(ctx, gnb)
+			},
+			fix: "start the gNB, and check it is reachable from this host (routes, firewall) at the address listed in `ran.gnbs`",
+		})
+	}
+	return checks
+}
+
+// kernelChecks are the checks required to configure the TUN interface;
+// with `--netns`, checks depending on the network namespace are run in the namespace of the TUN interface
+func (d *Doctor) kernelChecks() []check {
+	nsChecks := []check{
+		{
+			name: "TUN device",
+			run:  checkTunDevice,
+			fix:  "load the tun module (`modprobe tun`), or make `/dev/net/tun` available in the container (docker compose: `devices: [\"/dev/net/tun\"]`); or set `tun.userspace: true`",
+		},
+		{
+			name: "netlink access",
+			run:  checkNetlink,
+			fix:  "run on Linux; reading links and rules does not require NET_ADMIN, so check netlink sockets are not blocked (e.g. by the seccomp profile of the container)",
+		},
+		{
+			name: "firewall backend",
+			run:  d.checkFirewall,
+			fix:  "enable nftables support in the kernel (`nf_tables` module), or install iptables; `tun.firewall` selects a backend",
+		},
+	}
+	if d.conf.Tun.Netns != "" {
+		for i := range nsChecks {
+			nsChecks[i].run = d.inNetns(nsChecks[i].run)
+		}
+	}
+	return append([]check{
+		{
+			name: "NET_ADMIN capability",
+			run:  checkNetAdmin,
+			fix:  "run as root, or add the NET_ADMIN capability (docker compose: `cap_add: [NET_ADMIN]`)",
+		},
+	}, nsChecks...)
+}
+
+// inNetns runs a check in the network namespace of the TUN interface.
+// Since the UE creates this namespace if it does not exist, the check is then run in the current namespace.
+func (d *Doctor) inNetns(run func(ctx context.Context) (string, error)) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		var detail string
+		err := tun.InNetns(d.conf.Tun.Netns, func() error {
+			var err error
+			detail, err = run(ctx)
+			return err
+		})
+		note := "in network namespace " + d.conf.Tun.Netns
+		var nsErr *tun.NetnsError
+		if errors.As(err, &nsErr) && nsErr.Op == "open" && errors.Is(nsErr.Err, fs.ErrNotExist) {
+			detail, err = run(ctx)
+			note = fmt.Sprintf("network namespace %s does not exist yet: checked in the current namespace", d.conf.Tun.Netns)
+		}
+		if err != nil {
+			return "", err
+		}
+		if detail == "" {
+			return note, nil
+		}
+		return fmt.Sprintf("%s (%s)", detail, note), nil
+	}
+}
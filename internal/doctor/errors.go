@@ -0,0 +1,13 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package doctor
+
+import "errors"
+
+var (
+	ErrMissingNetAdmin     = errors.New("the NET_ADMIN capability is not in the effective set")
+	ErrUnknownCapabilities = errors.New("could not read the capabilities of the process")
+)
@@ -0,0 +1,109 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package echo
+
+import (
+	"net"
+	"net/netip"
+	"time"
+)
+
+// Maximum size of a received packet
+const RECEIVE_MAX = 65535
+
+// Conn sends sequence-numbered and timestamped packets to a target that echoes them back:
+// an UDP echo server, or any host answering ICMP echo requests.
+// Send and Receive may be called concurrently, but not Send (or Receive) with itself.
+type Conn struct {
+	conn    net.Conn
+	icmp    bool
+	ueIp    netip.Addr
+	id      uint32
+	start   time.Time
+	payload []byte
+	buf     []byte
+}
+
+// NewConn uses conn, connected from the UE IP Address to the target, to send packets of this size (IP header included).
+// The id identifies the packets of this Conn; conn is an ICMP connection (ICMP header included) if icmp is true.
+func NewConn(conn net.Conn, icmp bool, ueIp netip.Addr, id uint32, size int) (*Conn, error) {
+	l := size - HeadersLen(icmp, ueIp)
+	if l < PAYLOAD_LEN {
+		return nil, ErrInvalidSize
+	}
+	return &Conn{
+		conn:    conn,
+		icmp:    icmp,
+		ueIp:    ueIp,
+		id:      id,
+		start:   time.Now(),
+		payload: make([]byte, l),
+		buf:     make([]byte, RECEIVE_MAX),
+	}, nil
+}
+
+// Elapsed returns the duration since the creation of the Conn; send times are relative to it
+func (c *Conn) Elapsed() time.Duration {
+	return time.Since(c.start)
+}
+
+// Start returns the creation time of the Conn
+func (c *Conn) Start() time.Time {
+	return c.start
+}
+
+// Send sends the packet with this sequence number, and returns its send time
+func (c *Conn) Send(seq uint64) (time.Duration, error) {
+	sent := c.Elapsed()
+	encodePayload(c.payload, c.id, seq, sent)
+	pkt := c.payload
+	if c.icmp {
+		var err error
+		if pkt, err = icmpEcho(c.ueIp, c.id, seq, c.payload); err != nil {
+			return sent, err
+		}
+	}
+	_, err := c.conn.Write(pkt)
+	return sent, err
+}
+
+// Receive waits for an echoed packet, and returns its sequence number, send time and round-trip time.
+// ErrInvalidPacket is returned for packets not sent by this Conn.
+func (c *Conn) Receive() (uint64, time.Duration, time.Duration, error) {
+	n, err := c.conn.Read(c.buf)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	received := c.Elapsed()
+	payload := c.buf[:n]
+	if c.icmp {
+		if payload, err = icmpEchoReplyPayload(c.ueIp, payload); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	seq, sent, err := decodePayload(payload, c.id)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return seq, sent, received - sent, nil
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// ParseTarget parses the address of a target: `ip:port`, or `ip` for ICMP
+func ParseTarget(target string, icmp bool) (netip.AddrPort, error) {
+	if ap, err := netip.ParseAddrPort(target); err == nil {
+		return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()), nil
+	}
+	if icmp {
+		if addr, err := netip.ParseAddr(target); err == nil {
+			return netip.AddrPortFrom(addr.Unmap(), 0), nil
+		}
+	}
+	return netip.AddrPort{}, ErrInvalidTarget
+}
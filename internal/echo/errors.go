@@ -0,0 +1,14 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package echo
+
+import "errors"
+
+var (
+	ErrInvalidPacket = errors.New("not a packet of this connection")
+	ErrInvalidSize   = errors.New("invalid packet size")
+	ErrInvalidTarget = errors.New("invalid target: use `ip:port` (udp) or `ip` (icmp)")
+)
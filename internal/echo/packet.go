@@ -0,0 +1,94 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package echo
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// Identifies payloads sent by ue-lite
+	PAYLOAD_MAGIC = 0x4e4d5447 // "NMTG"
+
+	// Length of the payload header: magic, id, sequence number, and send time
+	PAYLOAD_LEN = 4 + 4 + 8 + 8
+
+	ipv4HeaderLen = 20
+	ipv6HeaderLen = 40
+	udpHeaderLen  = 8
+	icmpHeaderLen = 8
+)
+
+// HeadersLen returns the length of IP and transport (UDP, or ICMP if icmp is true) headers
+func HeadersLen(icmp bool, ueIp netip.Addr) int {
+	l := ipv4HeaderLen
+	if ueIp.Is6() {
+		l = ipv6HeaderLen
+	}
+	if icmp {
+		return l + icmpHeaderLen
+	}
+	return l + udpHeaderLen
+}
+
+// encodePayload writes the payload header at the beginning of b; sent is the send time relative to the start of the connection
+func encodePayload(b []byte, id uint32, seq uint64, sent time.Duration) {
+	binary.BigEndian.PutUint32(b[0:], PAYLOAD_MAGIC)
+	binary.BigEndian.PutUint32(b[4:], id)
+	binary.BigEndian.PutUint64(b[8:], seq)
+	binary.BigEndian.PutUint64(b[16:], uint64(sent))
+}
+
+// decodePayload returns the sequence number and send time of a payload with this id
+func decodePayload(b []byte, id uint32) (uint64, time.Duration, error) {
+	if len(b) < PAYLOAD_LEN || binary.BigEndian.Uint32(b[0:]) != PAYLOAD_MAGIC || binary.BigEndian.Uint32(b[4:]) != id {
+		return 0, 0, ErrInvalidPacket
+	}
+	return binary.BigEndian.Uint64(b[8:]), time.Duration(binary.BigEndian.Uint64(b[16:])), nil
+}
+
+// icmpEcho returns an echo request carrying this payload
+func icmpEcho(ueIp netip.Addr, id uint32, seq uint64, payload []byte) ([]byte, error) {
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{
+			ID:   int(id & 0xffff),
+			Seq:  int(seq & 0xffff),
+			Data: payload,
+		},
+	}
+	if ueIp.Is6() {
+		// the checksum is computed by the network stack
+		msg.Type = ipv6.ICMPTypeEchoRequest
+	}
+	return msg.Marshal(nil)
+}
+
+// icmpEchoReplyPayload returns the payload of an echo reply
+func icmpEchoReplyPayload(ueIp netip.Addr, b []byte) ([]byte, error) {
+	proto := 1 // ICMP
+	if ueIp.Is6() {
+		proto = 58 // ICMPv6
+	}
+	msg, err := icmp.ParseMessage(proto, b)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != ipv4.ICMPTypeEchoReply && msg.Type != ipv6.ICMPTypeEchoReply {
+		return nil, ErrInvalidPacket
+	}
+	echo, ok := msg.Body.(*icmp.Echo)
+	if !ok {
+		return nil, ErrInvalidPacket
+	}
+	return echo.Data, nil
+}
@@ -0,0 +1,86 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package echo
+
+import (
+	"context"
+	"time"
+)
+
+// Period of the detection of lost packets
+const LOSS_CHECK_PERIOD = 100 * time.Millisecond
+
+// Pending tracks the packets waiting for an answer, to count the ones not answered before a timeout as lost.
+// Packets must be added in send order, so expiration stops at the first packet that has not expired.
+// It is not safe for concurrent use.
+type Pending struct {
+	sent  map[uint64]time.Duration // key: sequence number; value: send time relative to the start of the connection
+	order []uint64                 // sequence numbers in send order; answered packets are removed when they reach the front
+	lost  uint64
+}
+
+func NewPending() *Pending {
+	return &Pending{
+		sent: make(map[uint64]time.Duration),
+	}
+}
+
+// Add registers a packet; it must be done before sending it, so a fast answer is not ignored
+func (p *Pending) Add(seq uint64, sent time.Duration) {
+	p.sent[seq] = sent
+	p.order = append(p.order, seq)
+}
+
+// Remove unregisters a packet that has been answered (or could not be sent), and returns its send time.
+// It returns false if the packet is unknown, already answered, or lost.
+func (p *Pending) Remove(seq uint64) (time.Duration, bool) {
+	sent, ok := p.sent[seq]
+	if ok {
+		delete(p.sent, seq)
+	}
+	return sent, ok
+}
+
+// Expire counts packets sent before deadline as lost
+func (p *Pending) Expire(deadline time.Duration) {
+	for len(p.order) > 0 {
+		seq := p.order[0]
+		if sent, ok := p.sent[seq]; ok {
+			if sent >= deadline {
+				return
+			}
+			delete(p.sent, seq)
+			p.lost++
+		}
+		p.order = p.order[1:]
+	}
+}
+
+// ExpireAll counts all packets as lost, e.g. when the connection is closed
+func (p *Pending) ExpireAll() {
+	p.lost += uint64(len(p.sent))
+	clear(p.sent)
+	p.order = nil
+}
+
+// Lost returns the number of lost packets
+func (p *Pending) Lost() uint64 {
+	return p.lost
+}
+
+// RunLossCheck calls check every LOSS_CHECK_PERIOD, until ctx is done
+func RunLossCheck(ctx context.Context, check func()) {
+	ticker := time.NewTicker(LOSS_CHECK_PERIOD)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
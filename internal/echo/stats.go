@@ -0,0 +1,52 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package echo
+
+import (
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/common"
+)
+
+// Delay statistics
+type DelayStatus struct {
+	Min common.Duration `json:"min"`
+	Avg common.Duration `json:"avg"`
+	Max common.Duration `json:"max"`
+}
+
+// DelayStats accumulates delays; the zero value has no delay.
+// Delays may be negative, e.g. one-way delays between hosts whose clocks are not synchronized.
+type DelayStats struct {
+	n   uint64
+	min time.Duration
+	max time.Duration
+	sum time.Duration
+}
+
+// Add accounts this delay
+func (s *DelayStats) Add(d time.Duration) {
+	if s.n == 0 || d < s.min {
+		s.min = d
+	}
+	if s.n == 0 || d > s.max {
+		s.max = d
+	}
+	s.sum += d
+	s.n++
+}
+
+// Status returns the statistics of the accounted delays, or zero values if there is none
+func (s DelayStats) Status() DelayStatus {
+	if s.n == 0 {
+		return DelayStatus{}
+	}
+	return DelayStatus{
+		Min: common.Duration(s.min),
+		Avg: common.Duration(s.sum / time.Duration(s.n)),
+		Max: common.Duration(s.max),
+	}
+}
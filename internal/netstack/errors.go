@@ -0,0 +1,29 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package netstack
+
+import (
+	"errors"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+var (
+	ErrClosed           = errors.New("network stack closed")
+	ErrShortBuffer      = errors.New("buffer too small for packet")
+	ErrUnknownIPVersion = errors.New("unknown IP version")
+)
+
+// StackError is returned when the network stack cannot be configured
+type StackError struct {
+	Op  string
+	Err tcpip.Error
+}
+
+func (e *StackError) Error() string {
+	return fmt.Sprintf("could not %s: %s", e.Op, e.Err)
+}
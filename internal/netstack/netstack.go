@@ -0,0 +1,180 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package netstack
+
+import (
+	"context"
+	"net"
+	"net/netip"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	// Identifier of the single NIC of the stack
+	NIC_ID tcpip.NICID = 1
+
+	// Number of outbound packets queued by the stack before being read
+	QUEUE_SIZE = 1024
+)
+
+// Stack is an in-process TCP/IP stack, used instead of a kernel TUN interface.
+// Packets sent by the stack are read with Read, and packets received from the Data Network are written with Write.
+type Stack struct {
+	stack  *stack.Stack
+	ep     *channel.Endpoint
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewStack creates a Stack with a single NIC of this MTU, routing all destinations through it
+func NewStack(mtu int) (*Stack, error) {
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol, icmp.NewProtocol4, icmp.NewProtocol6},
+		HandleLocal:        true,
+	})
+	ep := channel.New(QUEUE_SIZE, uint32(mtu), "")
+	if err := s.CreateNIC(NIC_ID, ep); err != nil {
+		s.Close()
+		return nil, &StackError{Op: "create NIC", Err: err}
+	}
+	s.SetRouteTable([]tcpip.Route{
+		{Destination: header.IPv4EmptySubnet, NIC: NIC_ID},
+		{Destination: header.IPv6EmptySubnet, NIC: NIC_ID},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Stack{
+		stack:  s,
+		ep:     ep,
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// Close stops the stack; pending and future calls to Read return ErrClosed
+func (s *Stack) Close() {
+	s.cancel()
+	s.ep.Close()
+	s.stack.Close()
+	s.stack.Wait()
+}
+
+// Read copies the next packet sent by the stack to buf, blocking until a packet is available
+func (s *Stack) Read(buf []byte) (int, error) {
+	pkt := s.ep.ReadContext(s.ctx)
+	if pkt == nil {
+		return 0, ErrClosed
+	}
+	defer pkt.DecRef()
+	view := pkt.ToView()
+	defer view.Release()
+	if view.Size() > len(buf) {
+		return 0, ErrShortBuffer
+	}
+	return view.Read(buf)
+}
+
+// Write delivers a packet to the stack
+func (s *Stack) Write(pdu []byte) (int, error) {
+	var proto tcpip.NetworkProtocolNumber
+	switch header.IPVersion(pdu) {
+	case header.IPv4Version:
+		proto = header.IPv4ProtocolNumber
+	case header.IPv6Version:
+		proto = header.IPv6ProtocolNumber
+	default:
+		return 0, ErrUnknownIPVersion
+	}
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(pdu),
+	})
+	defer pkt.DecRef()
+	s.ep.InjectInbound(proto, pkt)
+	return len(pdu), nil
+}
+
+// AddAddr adds a UE IP Address to the stack
+func (s *Stack) AddAddr(prefix netip.Prefix) error {
+	addr := tcpip.ProtocolAddress{
+		Protocol: protocol(prefix.Addr()),
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   tcpip.AddrFromSlice(prefix.Addr().AsSlice()),
+			PrefixLen: prefix.Bits(),
+		},
+	}
+	if err := s.stack.AddProtocolAddress(NIC_ID, addr, stack.AddressProperties{}); err != nil {
+		return &StackError{Op: "add address " + prefix.String(), Err: err}
+	}
+	return nil
+}
+
+// DelAddr removes a UE IP Address from the stack
+func (s *Stack) DelAddr(ip netip.Addr) error {
+	if err := s.stack.RemoveAddress(NIC_ID, tcpip.AddrFromSlice(ip.AsSlice())); err != nil {
+		return &StackError{Op: "remove address " + ip.String(), Err: err}
+	}
+	return nil
+}
+
+// DialContext connects to dst from the UE IP Address src; network is "tcp", "udp" or "icmp".
+// ICMP connections send and receive echo messages (ICMP header included); the identifier is chosen by the stack.
+func (s *Stack) DialContext(ctx context.Context, network string, src netip.Addr, dst netip.AddrPort) (net.Conn, error) {
+	laddr := tcpip.FullAddress{NIC: NIC_ID, Addr: tcpip.AddrFromSlice(src.AsSlice())}
+	raddr := tcpip.FullAddress{NIC: NIC_ID, Addr: tcpip.AddrFromSlice(dst.Addr().Unmap().AsSlice()), Port: dst.Port()}
+	switch network {
+	case "tcp":
+		return gonet.DialTCPWithBind(ctx, s.stack, laddr, raddr, protocol(src))
+	case "udp":
+		return gonet.DialUDP(s.stack, &laddr, &raddr, protocol(src))
+	case "icmp":
+		return s.dialIcmp(laddr, raddr, protocol(src))
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+}
+
+// dialIcmp creates an ICMP echo endpoint connected to raddr
+func (s *Stack) dialIcmp(laddr tcpip.FullAddress, raddr tcpip.FullAddress, proto tcpip.NetworkProtocolNumber) (net.Conn, error) {
+	transport := icmp.ProtocolNumber4
+	if proto == header.IPv6ProtocolNumber {
+		transport = icmp.ProtocolNumber6
+	}
+	var wq waiter.Queue
+	ep, err := s.stack.NewEndpoint(transport, proto, &wq)
+	if err != nil {
+		return nil, &StackError{Op: "create ICMP endpoint", Err: err}
+	}
+	if err := ep.Bind(laddr); err != nil {
+		ep.Close()
+		return nil, &StackError{Op: "bind ICMP endpoint", Err: err}
+	}
+	raddr.Port = 0
+	if err := ep.Connect(raddr); err != nil {
+		ep.Close()
+		return nil, &StackError{Op: "connect ICMP endpoint", Err: err}
+	}
+	return gonet.NewUDPConn(&wq, ep), nil
+}
+
+// protocol returns the network protocol of this address
+func protocol(ip netip.Addr) tcpip.NetworkProtocolNumber {
+	if ip.Unmap().Is4() {
+		return header.IPv4ProtocolNumber
+	}
+	return header.IPv6ProtocolNumber
+}
@@ -0,0 +1,15 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package probe
+
+import "errors"
+
+var (
+	ErrUnknownProtocol = errors.New("unknown protocol: use udp or icmp")
+	ErrAddressFamily   = errors.New("the target is not of the address family of the PDU Session")
+	ErrInvalidInterval = errors.New("invalid interval: the minimum is 1ms, and the maximum is 2*window+timeout")
+	ErrInvalidConfig   = errors.New("invalid timeout or window")
+)
@@ -0,0 +1,142 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package probe
+
+import (
+	"context"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/common"
+	"github.com/nextmn/ue-lite/internal/echo"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Number of handover reports kept by a probe
+const HANDOVER_REPORTS_MAX = 100
+
+// HandoverReport describes the traffic of a probe around a handover.
+// Packets sent from `window` before the start of the handover, to `window` after its end, are used.
+type HandoverReport struct {
+	SourceGnb jsonapi.ControlURI `json:"source-gnb"`
+	TargetGnb jsonapi.ControlURI `json:"target-gnb"`
+	Start     time.Time          `json:"start"`    // reception of the Handover Command
+	Duration  common.Duration    `json:"duration"` // processing of the Handover Command, until the Handover Confirm is sent
+	Success   bool               `json:"success"`  // the PDU Session has been updated
+
+	Sent     uint64 `json:"sent"` // packets sent during the window, including those that could not be sent
+	Received uint64 `json:"received"`
+	Lost     uint64 `json:"lost"` // packets not answered before the timeout, or that could not be sent
+
+	// Longest period between consecutive answered packets (by send time);
+	// it is the interval between packets when none is lost.
+	Gap common.Duration  `json:"gap"`
+	Rtt echo.DelayStatus `json:"rtt"`
+}
+
+// Handover is a handover being measured
+type Handover struct {
+	probe     *Probe
+	sourceGnb jsonapi.ControlURI
+	targetGnb jsonapi.ControlURI
+	start     time.Time
+	startRel  time.Duration // start, relative to the start of the connection
+}
+
+// Handover starts the measurement of a handover of the PDU Session; Done must be called when it ends
+func (p *Probe) Handover(sourceGnb jsonapi.ControlURI, targetGnb jsonapi.ControlURI) *Handover {
+	return &Handover{
+		probe:     p,
+		sourceGnb: sourceGnb,
+		targetGnb: targetGnb,
+		start:     time.Now(),
+		startRel:  p.conn.Elapsed(),
+	}
+}
+
+// Done ends the handover; the report is added to the probe once the packets sent after it are answered or lost
+func (h *Handover) Done(ctx context.Context, success bool) {
+	end := h.probe.conn.Elapsed()
+	go func() {
+		timer := time.NewTimer(h.probe.conf.Window + h.probe.conf.Timeout + echo.LOSS_CHECK_PERIOD)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		r := h.probe.measure(h.startRel-h.probe.conf.Window, end+h.probe.conf.Window)
+		r.SourceGnb = h.sourceGnb
+		r.TargetGnb = h.targetGnb
+		r.Start = h.start
+		r.Duration = common.Duration(end - h.startRel)
+		r.Success = success
+		h.probe.addReport(r)
+		logrus.WithFields(logrus.Fields{
+			"ue-ip-addr": h.probe.ueIp,
+			"source-gnb": h.sourceGnb.String(),
+			"target-gnb": h.targetGnb.String(),
+			"success":    success,
+			"sent":       r.Sent,
+			"lost":       r.Lost,
+			"gap":        time.Duration(r.Gap),
+			"rtt-max":    time.Duration(r.Rtt.Max),
+		}).Info("Handover measured")
+	}()
+}
+
+// measure returns the statistics of packets sent between from and to (relative to the start of the connection)
+func (p *Probe) measure(from time.Duration, to time.Duration) HandoverReport {
+	var r HandoverReport
+	var rtt echo.DelayStats
+	var gap time.Duration
+	var last time.Duration // send time of the last answered packet (initially: of the first packet)
+	var end time.Duration  // send time of the last packet
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := uint64(len(p.records))
+	first := uint64(0)
+	if p.nextSeq > n {
+		first = p.nextSeq - n
+	}
+	for seq := first; seq < p.nextSeq; seq++ {
+		rec := p.records[seq%n]
+		if rec.seq != seq || rec.sent < from {
+			continue
+		}
+		if rec.sent > to {
+			break
+		}
+		if r.Sent == 0 {
+			last = rec.sent
+		}
+		r.Sent++
+		end = rec.sent
+		if rec.state != stateReceived {
+			r.Lost++
+			continue
+		}
+		r.Received++
+		rtt.Add(rec.rtt)
+		gap = max(gap, rec.sent-last)
+		last = rec.sent
+	}
+	r.Gap = common.Duration(max(gap, end-last))
+	r.Rtt = rtt.Status()
+	return r
+}
+
+// addReport adds a handover report, and removes the oldest one if there are too many
+func (p *Probe) addReport(r HandoverReport) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.handovers) >= HANDOVER_REPORTS_MAX {
+		p.handovers = p.handovers[1:]
+	}
+	p.handovers = append(p.handovers, r)
+}
@@ -0,0 +1,246 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package probe
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/config"
+	"github.com/nextmn/ue-lite/internal/echo"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DEFAULT_INTERVAL = 10 * time.Millisecond
+	DEFAULT_SIZE     = 64 // IP header included
+	DEFAULT_TIMEOUT  = time.Second
+	DEFAULT_WINDOW   = time.Second
+
+	MIN_INTERVAL = time.Millisecond
+
+	// Packets sent during this period are kept to measure handovers
+	HISTORY = 30 * time.Second
+)
+
+// DialFunc opens a connection from the UE IP Address of the PDU Session to dst
+type DialFunc func(ctx context.Context, network string, dst netip.AddrPort) (net.Conn, error)
+
+type recordState uint8
+
+const (
+	statePending recordState = iota
+	stateReceived
+	stateLost
+	stateSendError
+)
+
+// record is a packet sent by the probe
+type record struct {
+	seq   uint64
+	sent  time.Duration // send time, relative to the start of the connection
+	rtt   time.Duration
+	state recordState
+}
+
+// Probe continuously sends packets from the UE IP Address of a PDU Session to an echo target
+type Probe struct {
+	ueIp    netip.Addr
+	target  netip.AddrPort
+	conf    config.Probe
+	dial    DialFunc
+	conn    *echo.Conn
+	closing atomic.Bool // the connection is being closed
+	done    chan struct{}
+
+	mu         sync.Mutex
+	records    []record // history of packets; index: sequence number modulo length
+	nextSeq    uint64   // sequence number of the next packet
+	checked    uint64   // packets with a lower sequence number are answered or lost
+	sent       uint64
+	received   uint64
+	lost       uint64
+	sendErrors uint64
+	rtt        echo.DelayStats
+	handovers  []HandoverReport
+}
+
+// NewProbe creates a Probe sending packets from the UE IP Address of the address family of the target
+// (IPv4v6 PDU Sessions have an IPv4 and an IPv6 address); default values are used for unset parameters of conf
+func NewProbe(ueIps []netip.Addr, conf config.Probe, dial DialFunc) (*Probe, error) {
+	conf.Interval = cmp.Or(conf.Interval, DEFAULT_INTERVAL)
+	conf.Size = cmp.Or(conf.Size, DEFAULT_SIZE)
+	conf.Timeout = cmp.Or(conf.Timeout, DEFAULT_TIMEOUT)
+	conf.Window = cmp.Or(conf.Window, DEFAULT_WINDOW)
+	switch conf.Protocol {
+	case config.ProbeProtocolUdp, config.ProbeProtocolIcmp:
+	default:
+		return nil, ErrUnknownProtocol
+	}
+	target, err := echo.ParseTarget(conf.Target, conf.Protocol == config.ProbeProtocolIcmp)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(ueIps, func(ueIp netip.Addr) bool {
+		return ueIp.Unmap().Is4() == target.Addr().Is4()
+	})
+	if i < 0 {
+		return nil, ErrAddressFamily
+	}
+	ueIp := ueIps[i]
+	if conf.Interval < MIN_INTERVAL {
+		return nil, ErrInvalidInterval
+	}
+	// the history must contain the packets of a handover until it is measured
+	if conf.Timeout <= 0 || conf.Window <= 0 || 2*conf.Window+conf.Timeout > HISTORY/2 {
+		return nil, ErrInvalidConfig
+	}
+	// a handover is measured with the packets sent during its windows
+	if conf.Interval > 2*conf.Window+conf.Timeout {
+		return nil, ErrInvalidInterval
+	}
+	return &Probe{
+		ueIp:    ueIp.Unmap(),
+		target:  target,
+		conf:    conf,
+		dial:    dial,
+		done:    make(chan struct{}),
+		records: make([]record, max(1, HISTORY/conf.Interval)),
+	}, nil
+}
+
+// Start sends packets until ctx is done
+func (p *Probe) Start(ctx context.Context) error {
+	conn, err := p.dial(ctx, string(p.conf.Protocol), p.target)
+	if err != nil {
+		return err
+	}
+	ec, err := echo.NewConn(conn, p.conf.Protocol == config.ProbeProtocolIcmp, p.ueIp, rand.Uint32(), p.conf.Size)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	p.conn = ec
+	logrus.WithFields(logrus.Fields{
+		"ue-ip-addr": p.ueIp,
+		"target":     p.target,
+		"protocol":   p.conf.Protocol,
+		"interval":   p.conf.Interval,
+	}).Info("Probe started")
+	go p.receive()
+	go p.run(ctx)
+	return nil
+}
+
+// WaitShutdown waits for the probe to be stopped
+func (p *Probe) WaitShutdown(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.done:
+		return nil
+	}
+}
+
+// run sends packets and detects lost ones until ctx is done
+func (p *Probe) run(ctx context.Context) {
+	defer close(p.done)
+	defer func() {
+		p.closing.Store(true)
+		p.conn.Close()
+	}()
+	go echo.RunLossCheck(ctx, p.checkLoss)
+	ticker := time.NewTicker(p.conf.Interval)
+	defer ticker.Stop()
+	p.send()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.send()
+		}
+	}
+}
+
+// send sends the next packet
+func (p *Probe) send() {
+	// registered before sending, so a fast answer is not ignored
+	p.mu.Lock()
+	seq := p.nextSeq
+	p.nextSeq++
+	r := &p.records[seq%uint64(len(p.records))]
+	*r = record{seq: seq, sent: p.conn.Elapsed(), state: statePending}
+	p.mu.Unlock()
+	if _, err := p.conn.Send(seq); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"ue-ip-addr": p.ueIp}).Trace("Could not send probe packet")
+		p.mu.Lock()
+		if r.seq == seq {
+			r.state = stateSendError
+		}
+		p.sendErrors++
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Lock()
+	p.sent++
+	p.mu.Unlock()
+}
+
+// receive reads answers of the target until the connection is closed
+func (p *Probe) receive() {
+	for {
+		seq, _, rtt, err := p.conn.Receive()
+		if err != nil {
+			if p.closing.Load() {
+				return
+			}
+			// e.g. ICMP errors reported on the socket, or packets of other probes
+			if !errors.Is(err, echo.ErrInvalidPacket) {
+				logrus.WithError(err).WithFields(logrus.Fields{"ue-ip-addr": p.ueIp}).Trace("Could not receive probe packet")
+			}
+			continue
+		}
+		p.mu.Lock()
+		if r := &p.records[seq%uint64(len(p.records))]; r.seq == seq && r.state == statePending {
+			r.state = stateReceived
+			r.rtt = rtt
+			p.received++
+			p.rtt.Add(rtt)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// checkLoss marks packets not answered before the timeout as lost
+func (p *Probe) checkLoss() {
+	deadline := p.conn.Elapsed() - p.conf.Timeout
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ; p.checked < p.nextSeq; p.checked++ {
+		r := &p.records[p.checked%uint64(len(p.records))]
+		if r.seq != p.checked {
+			// overwritten
+			continue
+		}
+		if r.sent >= deadline {
+			return
+		}
+		if r.state == statePending {
+			r.state = stateLost
+			p.lost++
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package probe
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/common"
+	"github.com/nextmn/ue-lite/internal/config"
+	"github.com/nextmn/ue-lite/internal/echo"
+)
+
+type ProbeStatus struct {
+	UeIpAddr netip.Addr           `json:"ue-ip-addr"`
+	Protocol config.ProbeProtocol `json:"protocol"`
+	Target   netip.AddrPort       `json:"target"`
+	Interval common.Duration      `json:"interval"`
+	Start    time.Time            `json:"start"`
+
+	Sent       uint64           `json:"sent"`
+	Received   uint64           `json:"received"`
+	Lost       uint64           `json:"lost"`        // packets not answered before the timeout
+	SendErrors uint64           `json:"send-errors"` // packets that could not be sent
+	Rtt        echo.DelayStatus `json:"rtt"`
+
+	Handovers []HandoverReport `json:"handovers"`
+}
+
+// Status returns the status of the probe
+func (p *Probe) Status() ProbeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ProbeStatus{
+		UeIpAddr:   p.ueIp,
+		Protocol:   p.conf.Protocol,
+		Target:     p.target,
+		Interval:   common.Duration(p.conf.Interval),
+		Start:      p.conn.Start(),
+		Sent:       p.sent,
+		Received:   p.received,
+		Lost:       p.lost,
+		SendErrors: p.sendErrors,
+		Rtt:        p.rtt.Status(),
+		Handovers:  append([]HandoverReport{}, p.handovers...),
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import "errors"
+
+var (
+	ErrUnknownProtocol = errors.New("unknown forward protocol")
+
+	ErrSocks5Version            = errors.New("unsupported SOCKS version")
+	ErrSocks5NoAcceptableMethod = errors.New("no acceptable SOCKS5 authentication method")
+	ErrSocks5Command            = errors.New("unsupported SOCKS5 command")
+	ErrSocks5AddressType        = errors.New("unsupported SOCKS5 address type")
+	ErrSocks5NoResolver         = errors.New("domain names are not supported without a DNS server reached through the PDU Session (`socks5-dns`)")
+)
@@ -0,0 +1,215 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// UDP flows are closed after this duration without traffic
+	UDP_IDLE_TIMEOUT = 60 * time.Second
+
+	// Maximum size of an UDP datagram
+	UDP_DATAGRAM_MAX = 65535
+)
+
+// DialFunc connects to dst in the Data Network; network is "tcp" or "udp"
+type DialFunc func(ctx context.Context, network string, dst netip.AddrPort) (net.Conn, error)
+
+// Forwarder relays connections (or UDP flows) accepted on a local address to a target in the Data Network
+type Forwarder struct {
+	conf   config.Forward
+	dial   DialFunc
+	closed chan struct{}
+}
+
+func NewForwarder(conf config.Forward, dial DialFunc) *Forwarder {
+	return &Forwarder{
+		conf:   conf,
+		dial:   dial,
+		closed: make(chan struct{}),
+	}
+}
+
+// Start listens on the local address, and relays until ctx is done
+func (f *Forwarder) Start(ctx context.Context) error {
+	switch f.conf.Protocol {
+	case config.ForwardProtocolTcp:
+		l, err := net.Listen("tcp", f.conf.Listen.String())
+		if err != nil {
+			return err
+		}
+		go f.close(ctx, l)
+		go f.serveTcp(ctx, l)
+	case config.ForwardProtocolUdp:
+		conn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(f.conf.Listen))
+		if err != nil {
+			return err
+		}
+		go f.close(ctx, conn)
+		go f.serveUdp(ctx, conn)
+	default:
+		return ErrUnknownProtocol
+	}
+	logrus.WithFields(logrus.Fields{
+		"protocol": f.conf.Protocol,
+		"listen":   f.conf.Listen,
+		"target":   f.conf.Target,
+	}).Info("Forwarding to the Data Network")
+	return nil
+}
+
+// close closes the listener when ctx is done
+func (f *Forwarder) close(ctx context.Context, l io.Closer) {
+	<-ctx.Done()
+	l.Close()
+	close(f.closed)
+}
+
+func (f *Forwarder) WaitShutdown(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-f.closed:
+		return nil
+	}
+}
+
+func (f *Forwarder) serveTcp(ctx context.Context, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"listen": f.conf.Listen}).Error("Forwarder stopped")
+			}
+			return
+		}
+		go f.relayTcp(ctx, conn)
+	}
+}
+
+// relayTcp relays a local connection to the target until one side closes it
+func (f *Forwarder) relayTcp(ctx context.Context, local net.Conn) {
+	defer local.Close()
+	remote, err := f.dial(ctx, "tcp", f.conf.Target)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"target": f.conf.Target}).Debug("Could not connect to target")
+		return
+	}
+	defer remote.Close()
+	relay(ctx, local, remote)
+}
+
+// relay copies data in both directions until both sides are closed, or ctx is done
+func relay(ctx context.Context, local net.Conn, remote net.Conn) {
+	stop := context.AfterFunc(ctx, func() {
+		local.Close()
+		remote.Close()
+	})
+	defer stop()
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		io.Copy(remote, local)
+		closeWrite(remote)
+	})
+	io.Copy(local, remote)
+	closeWrite(local)
+	wg.Wait()
+}
+
+// closeWrite shuts down the writing side of the connection, if supported
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+	}
+}
+
+// serveUdp relays datagrams of each local client through its own flow to the target
+func (f *Forwarder) serveUdp(ctx context.Context, local *net.UDPConn) {
+	var mu sync.Mutex
+	flows := make(map[netip.AddrPort]net.Conn)
+	// flow returns the flow of this client, dialing a new one on a miss
+	flow := func(client netip.AddrPort) (net.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if remote, ok := flows[client]; ok {
+			return remote, nil
+		}
+		remote, err := f.dial(ctx, "udp", f.conf.Target)
+		if err != nil {
+			return nil, err
+		}
+		flows[client] = remote
+		go func() {
+			f.relayUdp(ctx, local, remote, client)
+			// removed before being closed, so next datagrams of the client use a new flow
+			mu.Lock()
+			if flows[client] == remote {
+				delete(flows, client)
+			}
+			mu.Unlock()
+			remote.Close()
+		}()
+		return remote, nil
+	}
+	buf := make([]byte, UDP_DATAGRAM_MAX)
+	for {
+		n, client, err := local.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"listen": f.conf.Listen}).Error("Forwarder stopped")
+			}
+			return
+		}
+		err = f.writeUdp(flow, client, buf[:n])
+		if errors.Is(err, net.ErrClosed) && ctx.Err() == nil {
+			// the flow has been closed after being idle while the datagram was relayed
+			err = f.writeUdp(flow, client, buf[:n])
+		}
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"target": f.conf.Target}).Trace("Datagram dropped")
+		}
+	}
+}
+
+// writeUdp relays a datagram of the client through its flow
+func (f *Forwarder) writeUdp(flow func(client netip.AddrPort) (net.Conn, error), client netip.AddrPort, datagram []byte) error {
+	remote, err := flow(client)
+	if err != nil {
+		return err
+	}
+	remote.SetReadDeadline(time.Now().Add(UDP_IDLE_TIMEOUT))
+	_, err = remote.Write(datagram)
+	return err
+}
+
+// relayUdp relays datagrams from the target to the local client, until the flow is idle
+func (f *Forwarder) relayUdp(ctx context.Context, local *net.UDPConn, remote net.Conn, client netip.AddrPort) {
+	stop := context.AfterFunc(ctx, func() { remote.Close() })
+	defer stop()
+	buf := make([]byte, UDP_DATAGRAM_MAX)
+	for {
+		remote.SetReadDeadline(time.Now().Add(UDP_IDLE_TIMEOUT))
+		n, err := remote.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := local.WriteToUDPAddrPort(buf[:n], client); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"client": client}).Trace("Datagram dropped")
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SOCKS5 protocol (RFC 1928)
+const (
+	SOCKS5_VERSION = 0x05
+
+	SOCKS5_METHOD_NO_AUTH       = 0x00
+	SOCKS5_METHOD_NO_ACCEPTABLE = 0xff
+
+	SOCKS5_CMD_CONNECT = 0x01
+
+	SOCKS5_ATYP_IPV4   = 0x01
+	SOCKS5_ATYP_DOMAIN = 0x03
+	SOCKS5_ATYP_IPV6   = 0x04
+
+	SOCKS5_REP_SUCCEEDED             = 0x00
+	SOCKS5_REP_GENERAL_FAILURE       = 0x01
+	SOCKS5_REP_NETWORK_UNREACHABLE   = 0x03
+	SOCKS5_REP_HOST_UNREACHABLE      = 0x04
+	SOCKS5_REP_CONNECTION_REFUSED    = 0x05
+	SOCKS5_REP_COMMAND_NOT_SUPPORTED = 0x07
+	SOCKS5_REP_ADDRESS_NOT_SUPPORTED = 0x08
+
+	// Maximum duration of the negotiation with a client
+	SOCKS5_HANDSHAKE_TIMEOUT = 10 * time.Second
+
+	// Port of the DNS server used to resolve domain names
+	DNS_PORT = 53
+)
+
+// Socks5Server is a SOCKS5 server (CONNECT only, without authentication) whose outgoing connections are created with dial.
+// Domain names are resolved by a DNS server reached with dial too, so the host resolver is never used.
+type Socks5Server struct {
+	listen   netip.AddrPort
+	dial     DialFunc
+	resolver *net.Resolver // nil if domain names are not supported
+	closed   chan struct{}
+}
+
+// NewSocks5Server creates a SOCKS5 server; domain names are refused if dns is not valid
+func NewSocks5Server(listen netip.AddrPort, dial DialFunc, dns netip.Addr) *Socks5Server {
+	s := &Socks5Server{
+		listen: listen,
+		dial:   dial,
+		closed: make(chan struct{}),
+	}
+	if dns.IsValid() {
+		s.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+				// the servers of the host are ignored
+				return dial(ctx, network, netip.AddrPortFrom(dns.Unmap(), DNS_PORT))
+			},
+		}
+	}
+	return s
+}
+
+// Start listens on the local address, and serves clients until ctx is done
+func (s *Socks5Server) Start(ctx context.Context) error {
+	l, err := net.Listen("tcp", s.listen.String())
+	if err != nil {
+		return err
+	}
+	go func(ctx context.Context, l net.Listener) {
+		<-ctx.Done()
+		l.Close()
+		close(s.closed)
+	}(ctx, l)
+	go s.serve(ctx, l)
+	logrus.WithFields(logrus.Fields{"listen": s.listen}).Info("SOCKS5 server started")
+	return nil
+}
+
+func (s *Socks5Server) WaitShutdown(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.closed:
+		return nil
+	}
+}
+
+func (s *Socks5Server) serve(ctx context.Context, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"listen": s.listen}).Error("SOCKS5 server stopped")
+			}
+			return
+		}
+		go func(conn net.Conn) {
+			if err := s.handle(ctx, conn); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"client": conn.RemoteAddr()}).Debug("SOCKS5 request failed")
+			}
+		}(conn)
+	}
+}
+
+// handle negotiates the method and handles the request of a client
+func (s *Socks5Server) handle(ctx context.Context, local net.Conn) error {
+	defer local.Close()
+	local.SetDeadline(time.Now().Add(SOCKS5_HANDSHAKE_TIMEOUT))
+
+	// method selection
+	var hdr [2]byte
+	if _, err := io.ReadFull(local, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[0] != SOCKS5_VERSION {
+		return ErrSocks5Version
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(local, methods); err != nil {
+		return err
+	}
+	method := byte(SOCKS5_METHOD_NO_ACCEPTABLE)
+	for _, m := range methods {
+		if m == SOCKS5_METHOD_NO_AUTH {
+			method = SOCKS5_METHOD_NO_AUTH
+		}
+	}
+	if _, err := local.Write([]byte{SOCKS5_VERSION, method}); err != nil {
+		return err
+	}
+	if method == SOCKS5_METHOD_NO_ACCEPTABLE {
+		return ErrSocks5NoAcceptableMethod
+	}
+
+	// request
+	var req [4]byte
+	if _, err := io.ReadFull(local, req[:]); err != nil {
+		return err
+	}
+	if req[0] != SOCKS5_VERSION {
+		return ErrSocks5Version
+	}
+	host, port, err := readSocks5Addr(local, req[3])
+	if err != nil {
+		if errors.Is(err, ErrSocks5AddressType) {
+			writeSocks5Reply(local, SOCKS5_REP_ADDRESS_NOT_SUPPORTED, nil)
+		}
+		return err
+	}
+	if req[1] != SOCKS5_CMD_CONNECT {
+		writeSocks5Reply(local, SOCKS5_REP_COMMAND_NOT_SUPPORTED, nil)
+		return ErrSocks5Command
+	}
+	remote, err := s.connect(ctx, host, port)
+	if err != nil {
+		writeSocks5Reply(local, socks5ReplyCode(err), nil)
+		return err
+	}
+	defer remote.Close()
+	if err := writeSocks5Reply(local, SOCKS5_REP_SUCCEEDED, remote.LocalAddr()); err != nil {
+		return err
+	}
+	local.SetDeadline(time.Time{})
+	relay(ctx, local, remote)
+	return nil
+}
+
+// connect connects to the first reachable address of host
+func (s *Socks5Server) connect(ctx context.Context, host string, port uint16) (net.Conn, error) {
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else if s.resolver == nil {
+		return nil, ErrSocks5NoResolver
+	} else {
+		addrs, err = s.resolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = s.dial(ctx, "tcp", netip.AddrPortFrom(addr.Unmap(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// readSocks5Addr reads the destination address of a request
+func readSocks5Addr(r io.Reader, atyp byte) (string, uint16, error) {
+	var host string
+	switch atyp {
+	case SOCKS5_ATYP_IPV4:
+		var a [4]byte
+		if _, err := io.ReadFull(r, a[:]); err != nil {
+			return "", 0, err
+		}
+		host = netip.AddrFrom4(a).String()
+	case SOCKS5_ATYP_IPV6:
+		var a [16]byte
+		if _, err := io.ReadFull(r, a[:]); err != nil {
+			return "", 0, err
+		}
+		host = netip.AddrFrom16(a).String()
+	case SOCKS5_ATYP_DOMAIN:
+		var l [1]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return "", 0, err
+		}
+		name := make([]byte, l[0])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", 0, err
+		}
+		host = string(name)
+	default:
+		return "", 0, ErrSocks5AddressType
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", 0, err
+	}
+	return host, binary.BigEndian.Uint16(port[:]), nil
+}
+
+// writeSocks5Reply writes a reply with the bound address (or an unspecified address if nil)
+func writeSocks5Reply(w io.Writer, rep byte, bound net.Addr) error {
+	addr := netip.AddrPortFrom(netip.IPv4Unspecified(), 0)
+	if bound != nil {
+		if a, err := netip.ParseAddrPort(bound.String()); err == nil {
+			addr = a
+		}
+	}
+	msg := []byte{SOCKS5_VERSION, rep, 0x00}
+	if ip := addr.Addr().Unmap(); ip.Is4() {
+		msg = append(msg, SOCKS5_ATYP_IPV4)
+		msg = append(msg, ip.AsSlice()...)
+	} else {
+		msg = append(msg, SOCKS5_ATYP_IPV6)
+		msg = append(msg, ip.AsSlice()...)
+	}
+	msg = binary.BigEndian.AppendUint16(msg, addr.Port())
+	_, err := w.Write(msg)
+	return err
+}
+
+// socks5ReplyCode returns the reply code matching a connection error
+func socks5ReplyCode(err error) byte {
+	switch {
+	case errors.Is(err, ErrSocks5NoResolver):
+		return SOCKS5_REP_ADDRESS_NOT_SUPPORTED
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return SOCKS5_REP_CONNECTION_REFUSED
+	case errors.Is(err, syscall.ENETUNREACH):
+		return SOCKS5_REP_NETWORK_UNREACHABLE
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return SOCKS5_REP_HOST_UNREACHABLE
+	default:
+		return SOCKS5_REP_GENERAL_FAILURE
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"net"
+	"net/netip"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// batchConn reads and writes several UDP datagrams per system call (recvmmsg/sendmmsg on Linux)
+type batchConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+func newBatchConn(srv *net.UDPConn) batchConn {
+	if srv == nil {
+		panic(errNilUdpConn)
+	}
+	if addr, ok := srv.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		return ipv6.NewPacketConn(srv)
+	}
+	return ipv4.NewPacketConn(srv)
+}
+
+// newMessages allocates messages with a single buffer each
+func newMessages(n int) []ipv4.Message {
+	ms := make([]ipv4.Message, n)
+	for i := range ms {
+		ms[i].Buffers = make([][]byte, 1)
+	}
+	return ms
+}
+
+// writeBatch sends all messages; messages that cannot be sent are skipped.
+func writeBatch(conn batchConn, ms []ipv4.Message) error {
+	var lastErr error
+	for len(ms) > 0 {
+		n, err := conn.WriteBatch(ms, 0)
+		if err != nil {
+			lastErr = err
+			n++ // skip the message that caused the error
+		}
+		ms = ms[min(n, len(ms)):]
+	}
+	return lastErr
+}
+
+// udpAddrCache avoids an allocation per PDU when converting gNB addresses; it is not safe for concurrent use
+type udpAddrCache map[netip.AddrPort]*net.UDPAddr
+
+func (c udpAddrCache) get(addr netip.AddrPort) *net.UDPAddr {
+	if a, ok := c[addr]; ok {
+		return a
+	}
+	a := net.UDPAddrFromAddrPort(addr)
+	c[addr] = a
+	return a
+}
@@ -0,0 +1,102 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"golang.org/x/net/ipv4"
+)
+
+const benchDatagramLen = 1400
+
+// newBenchConns returns two connected batchConns on the loopback interface
+func newBenchConns(b *testing.B) (src batchConn, dst batchConn, dstAddr *net.UDPAddr) {
+	b.Helper()
+	rx, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { rx.Close() })
+	rx.SetReadBuffer(8 << 20)
+	tx, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { tx.Close() })
+	tx.SetWriteBuffer(8 << 20)
+	return newBatchConn(tx), newBatchConn(rx), rx.LocalAddr().(*net.UDPAddr)
+}
+
+// newBenchMessages returns a batch of datagrams to addr
+func newBenchMessages(addr *net.UDPAddr) []ipv4.Message {
+	ms := newMessages(RADIO_BATCH_SIZE)
+	for i := range ms {
+		ms[i].Buffers[0] = make([]byte, benchDatagramLen)
+		ms[i].Addr = addr
+	}
+	return ms
+}
+
+// drain reads datagrams from conn until ctx is done
+func drain(ctx context.Context, conn batchConn) {
+	ms := newMessages(RADIO_BATCH_SIZE)
+	for i := range ms {
+		ms[i].Buffers[0] = getBuffer()
+	}
+	for ctx.Err() == nil {
+		if _, err := conn.ReadBatch(ms, 0); err != nil {
+			return
+		}
+	}
+}
+
+// flood writes datagrams to addr using conn until ctx is done
+func flood(ctx context.Context, conn batchConn, addr *net.UDPAddr) {
+	ms := newBenchMessages(addr)
+	for ctx.Err() == nil {
+		if err := writeBatch(conn, ms); err != nil {
+			return
+		}
+	}
+}
+
+func BenchmarkBatchConnWrite(b *testing.B) {
+	src, dst, addr := newBenchConns(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go drain(ctx, dst)
+	ms := newBenchMessages(addr)
+	b.SetBytes(benchDatagramLen)
+	b.ResetTimer()
+	for sent := 0; sent < b.N; sent += len(ms) {
+		if err := writeBatch(src, ms[:min(len(ms), b.N-sent)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBatchConnRead(b *testing.B) {
+	src, dst, addr := newBenchConns(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go flood(ctx, src, addr)
+	ms := newMessages(RADIO_BATCH_SIZE)
+	for i := range ms {
+		ms[i].Buffers[0] = getBuffer()
+	}
+	b.SetBytes(benchDatagramLen)
+	b.ResetTimer()
+	for received := 0; received < b.N; {
+		n, err := dst.ReadBatch(ms[:min(len(ms), b.N-received)], 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		received += n
+	}
+}
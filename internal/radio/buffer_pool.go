@@ -0,0 +1,76 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"sync"
+
+	"github.com/nextmn/ue-lite/internal/tun"
+)
+
+const (
+	// Maximum number of PDUs read or written with a single system call
+	RADIO_BATCH_SIZE = 64
+	// Size of the buffers used for PDUs of the usual MTU (1500 bytes) and smaller
+	SMALL_BUFFER_LEN = 2048
+)
+
+// Buffers large enough for any PDU of the data path, used for reads.
+// Arrays are pooled instead of slices to avoid allocations on Put.
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new([tun.TAP_FRAME_MAX]byte)
+	},
+}
+
+// Buffers for PDUs of at most SMALL_BUFFER_LEN bytes, used while PDUs are delayed
+var smallBufferPool = sync.Pool{
+	New: func() any {
+		return new([SMALL_BUFFER_LEN]byte)
+	},
+}
+
+// getBuffer returns a buffer from the pool; it must be released with putBuffer
+func getBuffer() []byte {
+	return bufferPool.Get().(*[tun.TAP_FRAME_MAX]byte)[:]
+}
+
+// getSmallBuffer returns a buffer of SMALL_BUFFER_LEN bytes from the pool; it must be released with putBuffer
+func getSmallBuffer() []byte {
+	return smallBufferPool.Get().(*[SMALL_BUFFER_LEN]byte)[:]
+}
+
+// putBuffer returns a buffer to the pool it has been obtained from.
+// Buffers that have not been obtained with getBuffer or getSmallBuffer are ignored.
+func putBuffer(buf []byte) {
+	switch cap(buf) {
+	case tun.TAP_FRAME_MAX:
+		bufferPool.Put((*[tun.TAP_FRAME_MAX]byte)(buf[:tun.TAP_FRAME_MAX]))
+	case SMALL_BUFFER_LEN:
+		smallBufferPool.Put((*[SMALL_BUFFER_LEN]byte)(buf[:SMALL_BUFFER_LEN]))
+	}
+}
+
+// clonePDU copies the PDU into a new buffer from the smallest suitable pool
+func clonePDU(pdu []byte) []byte {
+	var buf []byte
+	if len(pdu) <= SMALL_BUFFER_LEN {
+		buf = getSmallBuffer()
+	} else {
+		buf = getBuffer()
+	}
+	n := copy(buf, pdu)
+	return buf[:n]
+}
+
+// shrinkPDU copies the PDU into a small buffer if it is held by a larger one.
+// If it returns true, the caller owns both buffers.
+func shrinkPDU(pdu []byte) ([]byte, bool) {
+	if len(pdu) > SMALL_BUFFER_LEN || cap(pdu) <= SMALL_BUFFER_LEN {
+		return pdu, false
+	}
+	return clonePDU(pdu), true
+}
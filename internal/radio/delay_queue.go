@@ -0,0 +1,148 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"container/heap"
+	"context"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Maximum size of the buffers held by a delay queue; further PDUs are dropped.
+// The capacity of the buffers is accounted, not the length of the PDUs, since it is the memory actually pinned.
+const DELAY_QUEUE_MAX_BYTES = 32 << 20
+
+type delayedPDU struct {
+	deadline time.Time
+	seq      uint64 // insertion order, used to keep FIFO order for identical deadlines
+	pdu      []byte
+	dst      netip.AddrPort
+}
+
+// pduHeap implements [heap.Interface], ordered by deadline then insertion order
+type pduHeap []delayedPDU
+
+func (h pduHeap) Len() int { return len(h) }
+func (h pduHeap) Less(i, j int) bool {
+	if h[i].deadline.Equal(h[j].deadline) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].deadline.Before(h[j].deadline)
+}
+func (h pduHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *pduHeap) Push(x any)   { *h = append(*h, x.(delayedPDU)) }
+func (h *pduHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = delayedPDU{} // do not retain the buffer
+	*h = old[:n-1]
+	return item
+}
+
+// delayQueue delays each PDU independently: pushing a PDU never blocks,
+// and PDUs are released by a single goroutine (see Run) once their deadline is reached.
+type delayQueue struct {
+	mu    sync.Mutex
+	items pduHeap
+	bytes int // sum of the capacity of the buffers in items
+	seq   uint64
+	wake  chan struct{}
+}
+
+func newDelayQueue() *delayQueue {
+	return &delayQueue{
+		items: make(pduHeap, 0),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+func newDelayQueues(n int) []*delayQueue {
+	queues := make([]*delayQueue, max(n, 1))
+	for i := range queues {
+		queues[i] = newDelayQueue()
+	}
+	return queues
+}
+
+// Push schedules the PDU to be sent to dst after delay.
+// The queue takes ownership of the pdu buffer, unless an error is returned.
+func (q *delayQueue) Push(pdu []byte, dst netip.AddrPort, delay time.Duration) error {
+	q.mu.Lock()
+	if q.bytes+cap(pdu) > DELAY_QUEUE_MAX_BYTES {
+		q.mu.Unlock()
+		return ErrDelayQueueFull
+	}
+	q.bytes += cap(pdu)
+	q.seq++
+	heap.Push(&q.items, delayedPDU{
+		deadline: time.Now().Add(delay),
+		seq:      q.seq,
+		pdu:      pdu,
+		dst:      dst,
+	})
+	first := q.items[0].seq == q.seq
+	q.mu.Unlock()
+	if first {
+		// the next deadline changed: wake up Run
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Run releases PDUs to out when their deadline is reached, until ctx is done.
+// PDUs whose deadline is reached at the same time are released together, by batches of at most RADIO_BATCH_SIZE PDUs.
+// The batch is only valid during the call to out; out takes ownership of the PDU buffers.
+func (q *delayQueue) Run(ctx context.Context, out func(batch []delayedPDU) error) error {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	batch := make([]delayedPDU, 0, RADIO_BATCH_SIZE)
+	for {
+		q.mu.Lock()
+		if len(q.items) == 0 {
+			q.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-q.wake:
+			}
+			continue
+		}
+		now := time.Now()
+		wait := q.items[0].deadline.Sub(now)
+		if wait <= 0 {
+			batch = batch[:0]
+			for len(q.items) > 0 && len(batch) < RADIO_BATCH_SIZE && !q.items[0].deadline.After(now) {
+				item := heap.Pop(&q.items).(delayedPDU)
+				q.bytes -= cap(item.pdu)
+				batch = append(batch, item)
+			}
+			q.mu.Unlock()
+			if err := out(batch); err != nil {
+				logrus.WithError(err).Trace("Could not send delayed PDUs")
+			}
+			clear(batch) // do not retain buffers
+			continue
+		}
+		q.mu.Unlock()
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-q.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
@@ -12,13 +12,29 @@ import (
 var (
 	// Programming errors (used for panicking)
 	errNilTunIface = errors.New("nil TUN interface")
+	errNilTapIface = errors.New("nil TAP interface")
 	errNilUdpConn  = errors.New("nil UDP Connection")
 
 	ErrUnknownGnb              = errors.New("unknown gNB")
 	ErrUnexpectedGnb           = errors.New("PDU session do not use the expected gNB")
 	ErrPduSessionNotFound      = errors.New("no PDU Session found for this IP Address")
 	ErrPduSessionAlreadyExists = errors.New("PDU session already exists")
+	ErrNoUeIpAddr              = errors.New("no UE IP Address for this PDU Session")
 
 	ErrUnsupportedPDUType = errors.New("unsupported PDU Type")
 	ErrMalformedPDU       = errors.New("malformed PDU")
+
+	ErrDelayQueueFull  = errors.New("delay queue is full")
+	ErrPDULost         = errors.New("PDU lost on the radio channel")
+	ErrTraceQueueFull  = errors.New("PDU dropped by the link trace")
+	ErrShaperQueueFull = errors.New("PDU dropped by the Session-AMBR shaper")
+
+	ErrUnknownLossModel          = errors.New("unknown loss model")
+	ErrUnknownJitterDistribution = errors.New("unknown jitter distribution")
+	ErrInvalidProbability        = errors.New("probability must be between 0 and 1")
+	ErrNegativeJitter            = errors.New("jitter must not be negative")
+
+	ErrEmptyTrace         = errors.New("empty trace file")
+	ErrMalformedTrace     = errors.New("malformed trace file")
+	ErrUnknownTraceFormat = errors.New("unknown trace format")
 )
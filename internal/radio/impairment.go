@@ -0,0 +1,192 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/config"
+)
+
+// linkImpairments are the impairments of the radio link with a gNB
+type linkImpairments struct {
+	uplink   *impairment
+	downlink *impairment
+}
+
+// impairment emulates a lossy radio channel in one direction
+type impairment struct {
+	mu    sync.Mutex
+	rng   *rand.Rand
+	conf  config.Impairment
+	trace trace // nil if no trace is used
+	bad   bool  // Gilbert-Elliott state
+}
+
+func newImpairment(conf config.Impairment, seed uint64, stream uint64) (*impairment, error) {
+	if err := validateImpairment(conf); err != nil {
+		return nil, err
+	}
+	i := &impairment{
+		rng:  rand.New(rand.NewPCG(seed, stream)),
+		conf: conf,
+	}
+	if conf.Trace != nil {
+		t, err := loadTrace(conf.Trace)
+		if err != nil {
+			return nil, err
+		}
+		i.trace = t
+	}
+	return i, nil
+}
+
+// validateImpairment checks the loss model, the jitter distribution, and that probabilities are in [0, 1]
+func validateImpairment(conf config.Impairment) error {
+	type probability struct {
+		name  string
+		value float64
+	}
+	probabilities := []probability{{"duplication", conf.Duplication}, {"reordering", conf.Reordering}}
+	if conf.Loss != nil {
+		switch conf.Loss.Model {
+		case config.LossModelRandom:
+			probabilities = append(probabilities, probability{"loss probability", conf.Loss.Probability})
+		case config.LossModelGilbertElliott:
+			probabilities = append(probabilities, probability{"loss p", conf.Loss.P}, probability{"loss r", conf.Loss.R}, probability{"loss-good", conf.Loss.LossGood})
+			if conf.Loss.LossBad != nil {
+				probabilities = append(probabilities, probability{"loss-bad", *conf.Loss.LossBad})
+			}
+		default:
+			return fmt.Errorf("%w: %q", ErrUnknownLossModel, conf.Loss.Model)
+		}
+	}
+	for _, p := range probabilities {
+		// also rejects NaN
+		if !(p.value >= 0 && p.value <= 1) {
+			return fmt.Errorf("%w: %s is %v", ErrInvalidProbability, p.name, p.value)
+		}
+	}
+	if conf.Jitter != nil {
+		switch conf.Jitter.Distribution {
+		case config.JitterDistributionUniform, config.JitterDistributionNormal, config.JitterDistributionExponential:
+		default:
+			return fmt.Errorf("%w: %q", ErrUnknownJitterDistribution, conf.Jitter.Distribution)
+		}
+		if conf.Jitter.Value < 0 {
+			return fmt.Errorf("%w: %s", ErrNegativeJitter, conf.Jitter.Value)
+		}
+	}
+	return nil
+}
+
+// newLinkImpairments creates the impairments for each gNB, with one random stream per gNB and direction.
+// If seed is nil, a random seed is used.
+func newLinkImpairments(conf []config.Impairments, seed *uint64) (map[string]*linkImpairments, error) {
+	s := rand.Uint64()
+	if seed != nil {
+		s = *seed
+	}
+	m := make(map[string]*linkImpairments, len(conf))
+	for i, c := range conf {
+		uplink, err := newImpairment(c.Uplink, s, uint64(2*i))
+		if err != nil {
+			return nil, fmt.Errorf("uplink impairments of gNB %s: %w", c.Gnb.String(), err)
+		}
+		downlink, err := newImpairment(c.Downlink, s, uint64(2*i+1))
+		if err != nil {
+			return nil, fmt.Errorf("downlink impairments of gNB %s: %w", c.Gnb.String(), err)
+		}
+		m[c.Gnb.String()] = &linkImpairments{
+			uplink:   uplink,
+			downlink: downlink,
+		}
+	}
+	return m, nil
+}
+
+// apply computes the delays of the copies of a PDU of this size entering the link at now,
+// given the configured one-way delay.
+// It returns n = 0 (and an error) if the PDU is dropped, and n = 2 if it is duplicated.
+func (i *impairment) apply(size int, now time.Time, base time.Duration) (delays [2]time.Duration, n int, err error) {
+	if i == nil {
+		return [2]time.Duration{base}, 1, nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.trace != nil {
+		d, ok := i.trace.delay(size, now, base)
+		if !ok {
+			return delays, 0, ErrTraceQueueFull
+		}
+		base = d
+	}
+	if i.lost() {
+		return delays, 0, ErrPDULost
+	}
+	n = 1
+	if i.conf.Duplication > 0 && i.rng.Float64() < i.conf.Duplication {
+		n = 2
+	}
+	for k := range n {
+		if i.conf.Reordering > 0 && i.rng.Float64() < i.conf.Reordering {
+			delays[k] = 0
+			continue
+		}
+		delays[k] = max(0, base+i.jitter())
+	}
+	return delays, n, nil
+}
+
+// lost returns true if the PDU must be dropped
+func (i *impairment) lost() bool {
+	if i.conf.Loss == nil {
+		return false
+	}
+	switch i.conf.Loss.Model {
+	case config.LossModelRandom:
+		return i.rng.Float64() < i.conf.Loss.Probability
+	case config.LossModelGilbertElliott:
+		if i.bad {
+			if i.rng.Float64() < i.conf.Loss.R {
+				i.bad = false
+			}
+		} else if i.rng.Float64() < i.conf.Loss.P {
+			i.bad = true
+		}
+		if i.bad {
+			lossBad := 1.0
+			if i.conf.Loss.LossBad != nil {
+				lossBad = *i.conf.Loss.LossBad
+			}
+			return i.rng.Float64() < lossBad
+		}
+		return i.rng.Float64() < i.conf.Loss.LossGood
+	default:
+		return false
+	}
+}
+
+// jitter returns a random delay variation
+func (i *impairment) jitter() time.Duration {
+	if i.conf.Jitter == nil || i.conf.Jitter.Value == 0 {
+		return 0
+	}
+	v := float64(i.conf.Jitter.Value)
+	switch i.conf.Jitter.Distribution {
+	case config.JitterDistributionUniform:
+		return time.Duration((2*i.rng.Float64() - 1) * v)
+	case config.JitterDistributionNormal:
+		return time.Duration(i.rng.NormFloat64() * v)
+	case config.JitterDistributionExponential:
+		return time.Duration(i.rng.ExpFloat64() * v)
+	default:
+		return 0
+	}
+}
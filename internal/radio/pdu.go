@@ -0,0 +1,118 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"hash/fnv"
+	"net/netip"
+
+	"github.com/nextmn/ue-lite/internal/common"
+
+	"github.com/songgao/water/waterutil"
+)
+
+const (
+	ipv4HeaderMinLen = 20
+	ipv6HeaderLen    = 40
+
+	ethernetHeaderLen = 14
+)
+
+// pduSource returns the source address of an IPv4 or IPv6 PDU
+func pduSource(pdu []byte) (netip.Addr, error) {
+	if len(pdu) == 0 {
+		return netip.Addr{}, ErrMalformedPDU
+	}
+	switch {
+	case waterutil.IsIPv4(pdu):
+		if len(pdu) < ipv4HeaderMinLen {
+			return netip.Addr{}, ErrMalformedPDU
+		}
+		return netip.AddrFrom4([4]byte(pdu[12:16])), nil
+	case waterutil.IsIPv6(pdu):
+		if len(pdu) < ipv6HeaderLen {
+			return netip.Addr{}, ErrMalformedPDU
+		}
+		return netip.AddrFrom16([16]byte(pdu[8:24])), nil
+	default:
+		return netip.Addr{}, ErrUnsupportedPDUType
+	}
+}
+
+// pduDestination returns the destination address of an IPv4 or IPv6 PDU
+func pduDestination(pdu []byte) (netip.Addr, error) {
+	if len(pdu) == 0 {
+		return netip.Addr{}, ErrMalformedPDU
+	}
+	switch {
+	case waterutil.IsIPv4(pdu):
+		if len(pdu) < ipv4HeaderMinLen {
+			return netip.Addr{}, ErrMalformedPDU
+		}
+		return netip.AddrFrom4([4]byte(pdu[16:20])), nil
+	case waterutil.IsIPv6(pdu):
+		if len(pdu) < ipv6HeaderLen {
+			return netip.Addr{}, ErrMalformedPDU
+		}
+		return netip.AddrFrom16([16]byte(pdu[24:40])), nil
+	default:
+		return netip.Addr{}, ErrUnsupportedPDUType
+	}
+}
+
+// frameSource returns the source MAC address of an Ethernet frame
+func frameSource(frame []byte) (common.MacAddr, error) {
+	if len(frame) < ethernetHeaderLen {
+		return common.MacAddr{}, ErrMalformedPDU
+	}
+	src, _ := common.MacAddrFromSlice(frame[6:12])
+	return src, nil
+}
+
+// frameDestination returns the destination MAC address of an Ethernet frame
+func frameDestination(frame []byte) (common.MacAddr, error) {
+	if len(frame) < ethernetHeaderLen {
+		return common.MacAddr{}, ErrMalformedPDU
+	}
+	dst, _ := common.MacAddrFromSlice(frame[0:6])
+	return dst, nil
+}
+
+const (
+	protoTCP  = 6
+	protoUDP  = 17
+	protoSCTP = 132
+)
+
+// flowHash returns a hash of the addresses, protocol and ports of a PDU,
+// so PDUs of the same flow are always handled by the same worker
+func flowHash(pdu []byte) uint32 {
+	h := fnv.New32a()
+	switch {
+	case len(pdu) >= ipv4HeaderMinLen && waterutil.IsIPv4(pdu):
+		h.Write(pdu[9:10])  // protocol
+		h.Write(pdu[12:20]) // addresses
+		ihl := int(pdu[0]&0x0f) * 4
+		if isTransportWithPorts(pdu[9]) && len(pdu) >= ihl+4 {
+			h.Write(pdu[ihl : ihl+4])
+		}
+	case len(pdu) >= ipv6HeaderLen && waterutil.IsIPv6(pdu):
+		h.Write(pdu[6:7])  // next header
+		h.Write(pdu[8:40]) // addresses
+		if isTransportWithPorts(pdu[6]) && len(pdu) >= ipv6HeaderLen+4 {
+			h.Write(pdu[ipv6HeaderLen : ipv6HeaderLen+4])
+		}
+	case len(pdu) >= ethernetHeaderLen:
+		h.Write(pdu[0:12]) // MAC addresses
+	default:
+		h.Write(pdu)
+	}
+	return h.Sum32()
+}
+
+func isTransportWithPorts(proto byte) bool {
+	return proto == protoTCP || proto == protoUDP || proto == protoSCTP
+}
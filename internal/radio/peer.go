@@ -29,7 +29,12 @@ func (r *Radio) Peer(c *gin.Context) {
 }
 
 func (r *Radio) HandlePeer(peer n1n2.RadioPeerMsg) {
-	r.peerMap.Store(peer.Control.String(), peer.Data)
+	if err := r.addPeer(peer.Control, peer.Data); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"peer-control": peer.Control.String(),
+			"peer-ran":     peer.Data,
+		}).Error("Could not update routes for this peer")
+	}
 	logrus.WithFields(logrus.Fields{
 		"peer-control": peer.Control.String(),
 		"peer-ran":     peer.Data,
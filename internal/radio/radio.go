@@ -9,13 +9,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"net"
+	"errors"
+	"io"
 	"net/http"
 	"net/netip"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nextmn/ue-lite/internal/common"
+	"github.com/nextmn/ue-lite/internal/config"
 	"github.com/nextmn/ue-lite/internal/tun"
 
 	"github.com/nextmn/json-api/jsonapi"
@@ -23,111 +27,452 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"github.com/songgao/water"
 )
 
 type Radio struct {
 	common.WithContext
 
-	Client       http.Client
-	peerMap      sync.Map // key: gnb control uri (string); value: gnb ran ip address
-	routingTable sync.Map // key: ueIp; value gnb control uri
-	Tun          *tun.TunManager
-	Control      jsonapi.ControlURI
-	Data         netip.AddrPort
-	UserAgent    string
-	delay        time.Duration
+	Client      http.Client
+	routes      atomic.Pointer[routingTable]
+	routesMu    sync.Mutex // serializes updates of routes
+	Tun         *tun.TunManager
+	Control     jsonapi.ControlURI
+	Data        netip.AddrPort
+	UserAgent   string
+	delay       time.Duration // uplink one-way delay
+	dlDelay     time.Duration // downlink one-way delay
+	uplink      []*delayQueue // one per worker
+	downlink    []*delayQueue // one per worker
+	impConf     []config.Impairments
+	seed        *uint64
+	impairments map[string]*linkImpairments // key: gnb control uri (string); protected by routesMu
 }
 
-func NewRadio(control jsonapi.ControlURI, tunMan *tun.TunManager, delay time.Duration, data netip.AddrPort, userAgent string) *Radio {
-	return &Radio{
-		peerMap:      sync.Map{},
-		routingTable: sync.Map{},
-		Client:       http.Client{},
-		Control:      control,
-		Data:         data,
-		UserAgent:    userAgent,
-		Tun:          tunMan,
-		delay:        delay,
+func NewRadio(control jsonapi.ControlURI, tunMan *tun.TunManager, delay time.Duration, dlDelay time.Duration, data netip.AddrPort, impairments []config.Impairments, seed *uint64, workers int, userAgent string) *Radio {
+	r := &Radio{
+		Client:    http.Client{},
+		Control:   control,
+		Data:      data,
+		UserAgent: userAgent,
+		Tun:       tunMan,
+		delay:     delay,
+		dlDelay:   dlDelay,
+		uplink:    newDelayQueues(workers),
+		downlink:  newDelayQueues(workers),
+		impConf:   impairments,
+		seed:      seed,
 	}
+	r.routes.Store(newRoutingTable())
+	return r
 }
 
-// AddRoute creates a route to the gNB for this PDU session, including configuration of iproute2 interface
-func (r *Radio) AddRoute(ueIp netip.Addr, gnb jsonapi.ControlURI) error {
-	if _, ok := r.peerMap.Load(gnb.String()); !ok {
-		return ErrUnknownGnb
+// initImpairments loads the configured radio channel impairments; it must be called before starting the data path
+func (r *Radio) initImpairments() error {
+	imp, err := newLinkImpairments(r.impConf, r.seed)
+	if err != nil {
+		return err
+	}
+	return r.updateRoutes(func(t *routingTable) error {
+		r.impairments = imp
+		// gNBs may have been peered already
+		for gnb, data := range t.gnbs {
+			t.peers[data] = imp[gnb]
+		}
+		for _, rt := range t.sessions {
+			n := *rt
+			n.imp = imp[rt.gnb.String()]
+			t.store(&n)
+		}
+		return nil
+	})
+}
+
+// addPeer updates the routes when the ran address of a gNB is known
+func (r *Radio) addPeer(gnb jsonapi.ControlURI, data netip.AddrPort) error {
+	data = netip.AddrPortFrom(data.Addr().Unmap(), data.Port())
+	return r.updateRoutes(func(t *routingTable) error {
+		if old, ok := t.gnbs[gnb.String()]; ok {
+			delete(t.peers, old)
+		}
+		t.gnbs[gnb.String()] = data
+		t.peers[data] = r.impairments[gnb.String()]
+		for _, rt := range t.sessions {
+			if rt.gnb.String() == gnb.String() {
+				n := *rt
+				n.gnbData = data
+				t.store(&n)
+			}
+		}
+		return nil
+	})
+}
+
+// newRoute creates the route of a PDU Session; routesMu must be held
+func (r *Radio) newRoute(t *routingTable, ueIp netip.Addr, gnb jsonapi.ControlURI, macs []common.MacAddr) (*route, error) {
+	data, ok := t.gnbs[gnb.String()]
+	if !ok {
+		return nil, ErrUnknownGnb
 	}
-	if _, loaded := r.routingTable.LoadOrStore(ueIp, gnb); loaded {
-		return ErrPduSessionAlreadyExists
+	if _, ok := t.session(ueIp); ok {
+		return nil, ErrPduSessionAlreadyExists
 	}
-	return r.Tun.AddIp(r.Context(), ueIp)
+	return &route{
+		ueIp:    ueIp,
+		gnb:     gnb,
+		gnbData: data,
+		imp:     r.impairments[gnb.String()],
+		macs:    macs,
+	}, nil
+}
+
+// AddRoute creates a route to the gNB for this PDU session, including configuration of iproute2 interface.
+// The first UE IP Address identifies the PDU Session; IPv4v6 PDU Sessions have an IPv4 and an IPv6 address.
+func (r *Radio) AddRoute(ueIps []netip.Addr, gnb jsonapi.ControlURI) error {
+	ueIps = unmapAll(ueIps)
+	if err := r.addIpRoute(ueIps, gnb, true); err != nil {
+		return err
+	}
+	for _, ueIp := range ueIps {
+		if err := r.Tun.AddIp(r.Context(), ueIp); err != nil {
+			// addresses already configured are removed with the route
+			if err := r.DelRoute(ueIps[0]); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"ue-ip-addr": ueIps}).Debug("Could not remove route of PDU Session")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// AddNetnsRoute creates a route to the gNB for this PDU session.
+// The UE IP Addresses are not configured on the TUN interface, since they are configured in a network namespace.
+func (r *Radio) AddNetnsRoute(ueIps []netip.Addr, gnb jsonapi.ControlURI) error {
+	return r.addIpRoute(unmapAll(ueIps), gnb, false)
+}
+
+func (r *Radio) addIpRoute(ueIps []netip.Addr, gnb jsonapi.ControlURI, tunAddr bool) error {
+	if len(ueIps) == 0 {
+		return ErrNoUeIpAddr
+	}
+	return r.updateRoutes(func(t *routingTable) error {
+		rt, err := r.newRoute(t, ueIps[0], gnb, nil)
+		if err != nil {
+			return err
+		}
+		for _, ueIp := range ueIps[1:] {
+			if _, ok := t.session(ueIp); ok {
+				return ErrPduSessionAlreadyExists
+			}
+		}
+		rt.ueIps = ueIps
+		rt.tunAddr = tunAddr
+		t.store(rt)
+		return nil
+	})
+}
+
+// unmapAll returns a copy of addrs with IPv4-mapped IPv6 addresses converted to IPv4 addresses
+func unmapAll(addrs []netip.Addr) []netip.Addr {
+	unmapped := make([]netip.Addr, len(addrs))
+	for i, addr := range addrs {
+		unmapped[i] = addr.Unmap()
+	}
+	return unmapped
+}
+
+// AddEthernetRoute creates a route to the gNB for this Ethernet PDU session.
+// The UE IP Address is only used to identify the PDU Session: no address is configured on the TAP interface.
+func (r *Radio) AddEthernetRoute(ueIp netip.Addr, macs []common.MacAddr, gnb jsonapi.ControlURI) error {
+	ueIp = ueIp.Unmap()
+	return r.updateRoutes(func(t *routingTable) error {
+		rt, err := r.newRoute(t, ueIp, gnb, slices.Clone(macs))
+		if err != nil {
+			return err
+		}
+		if rt.macs == nil {
+			rt.macs = []common.MacAddr{}
+		}
+		for _, mac := range macs {
+			if _, ok := t.macs[mac]; ok {
+				return ErrPduSessionAlreadyExists
+			}
+		}
+		t.store(rt)
+		return nil
+	})
 }
 
 // DelRoute remove the route to the gNB for this PDU session, including (de-)configuration of iproute2 interface
 func (r *Radio) DelRoute(ueIp netip.Addr) error {
-	r.routingTable.Delete(ueIp)
-	return r.Tun.DelIp(r.Context(), ueIp)
+	ueIp = ueIp.Unmap()
+	var tunAddrs []netip.Addr
+	if err := r.updateRoutes(func(t *routingTable) error {
+		rt, ok := t.session(ueIp)
+		if !ok {
+			return nil
+		}
+		if rt.tunAddr {
+			tunAddrs = rt.ueIps
+		}
+		t.delete(rt)
+		return nil
+	}); err != nil {
+		return err
+	}
+	var errs []error
+	for _, ip := range tunAddrs {
+		errs = append(errs, r.Tun.DelIp(r.Context(), ip))
+	}
+	return errors.Join(errs...)
 }
 
-// UpdateRoute updates the route to the gNB for this PDU Session
-func (r *Radio) UpdateRoute(ueIp netip.Addr, oldGnb jsonapi.ControlURI, newGnb jsonapi.ControlURI) error {
-	if _, ok := r.peerMap.Load(newGnb.String()); !ok {
-		return ErrUnknownGnb
+// SessionAddrs returns the UE IP Addresses of the PDU Session using this UE IP Address, starting with the one identifying it
+func (r *Radio) SessionAddrs(ueIp netip.Addr) ([]netip.Addr, bool) {
+	rt, ok := r.routes.Load().session(ueIp.Unmap())
+	if !ok {
+		return nil, false
+	}
+	if rt.isEthernet() {
+		return []netip.Addr{rt.ueIp}, true
 	}
-	old, ok := r.routingTable.Load(ueIp)
+	return slices.Clone(rt.ueIps), true
+}
+
+// SetAmbr sets the Session-AMBR of this PDU Session; a zero Bitrate means no limit
+func (r *Radio) SetAmbr(ueIp netip.Addr, ambr config.Ambr) error {
+	ueIp = ueIp.Unmap()
+	return r.updateRoutes(func(t *routingTable) error {
+		rt, ok := t.session(ueIp)
+		if !ok {
+			return ErrPduSessionNotFound
+		}
+		sh := rt.shapers
+		if sh == nil {
+			sh = &sessionShapers{}
+		}
+		sh.uplink.set(ambr.Uplink)
+		sh.downlink.set(ambr.Downlink)
+		n := *rt
+		n.shapers = sh
+		t.store(&n)
+		return nil
+	})
+}
+
+// GetAmbr returns the Session-AMBR of this PDU Session
+func (r *Radio) GetAmbr(ueIp netip.Addr) (config.Ambr, error) {
+	rt, ok := r.routes.Load().session(ueIp.Unmap())
 	if !ok {
-		return ErrPduSessionNotFound
+		return config.Ambr{}, ErrPduSessionNotFound
 	}
-	oldT := old.(jsonapi.ControlURI)
-	if oldT.String() != oldGnb.String() {
-		return ErrUnexpectedGnb
+	if rt.shapers == nil {
+		return config.Ambr{}, nil
 	}
+	return rt.shapers.Ambr(), nil
+}
 
-	r.routingTable.Store(ueIp, newGnb)
-	return nil
+// UpdateRoute updates the route to the gNB for this PDU Session
+func (r *Radio) UpdateRoute(ueIp netip.Addr, oldGnb jsonapi.ControlURI, newGnb jsonapi.ControlURI) error {
+	ueIp = ueIp.Unmap()
+	return r.updateRoutes(func(t *routingTable) error {
+		data, ok := t.gnbs[newGnb.String()]
+		if !ok {
+			return ErrUnknownGnb
+		}
+		rt, ok := t.session(ueIp)
+		if !ok {
+			return ErrPduSessionNotFound
+		}
+		if rt.gnb.String() != oldGnb.String() {
+			return ErrUnexpectedGnb
+		}
+		n := *rt
+		n.gnb = newGnb
+		n.gnbData = data
+		n.imp = r.impairments[newGnb.String()]
+		t.store(&n)
+		return nil
+	})
 }
 
 func (r *Radio) GetRoutes() map[netip.Addr]jsonapi.ControlURI {
 	sessions := make(map[netip.Addr]jsonapi.ControlURI)
-	r.routingTable.Range(func(key, value any) bool {
-		sessions[key.(netip.Addr)] = value.(jsonapi.ControlURI)
+	for ueIp, rt := range r.routes.Load().sessions {
+		sessions[ueIp] = rt.gnb
+		for _, ip := range rt.ueIps[min(1, len(rt.ueIps)):] {
+			sessions[ip] = rt.gnb
+		}
 		logrus.WithFields(logrus.Fields{
-			"key":   key.(netip.Addr),
-			"value": value.(jsonapi.ControlURI),
+			"key":   ueIp,
+			"value": rt.gnb,
 		}).Trace("Creating ps/status response")
-		return true
-	})
+	}
 	return sessions
 }
 
-func (r *Radio) Write(ctx context.Context, pkt []byte, srv *net.UDPConn, ue netip.Addr) error {
-	radioCtx := r.Context()
-	gnb, ok := r.routingTable.Load(ue)
+// downlinkRoute returns the route of the PDU Session a downlink PDU belongs to
+func (t *routingTable) downlinkRoute(pdu []byte) (*route, bool) {
+	if t.isEthernetPDU(pdu) {
+		dst, err := frameDestination(pdu)
+		if err != nil {
+			return nil, false
+		}
+		rt, ok := t.macs[dst]
+		return rt, ok
+	}
+	dst, err := pduDestination(pdu)
+	if err != nil {
+		return nil, false
+	}
+	rt, ok := t.ips[dst]
+	return rt, ok
+}
+
+// isEthernetPDU returns true if this downlink PDU must be forwarded to the TAP interface
+func (t *routingTable) isEthernetPDU(pdu []byte) bool {
+	if len(pdu) < ethernetHeaderLen {
+		return false
+	}
+	dst, _ := common.MacAddrFromSlice(pdu[0:6])
+	if _, ok := t.macs[dst]; ok {
+		return true
+	}
+	// broadcast and multicast frames (ff:…, 01:…, 33:33:…) cannot be mistaken for IP packets
+	_, err := pduSource(pdu)
+	return err == ErrUnsupportedPDUType
+}
+
+// Write schedules an uplink packet of an IP PDU Session to be sent to the gNB after the one-way delay.
+// This function does not block: the Radio takes ownership of the pkt buffer, unless an error is returned.
+func (r *Radio) Write(ctx context.Context, pkt []byte, ue netip.Addr) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rt, ok := r.routes.Load().ips[ue]
 	if !ok {
 		logrus.Trace("PDU Session not found for this IP Address")
 		return ErrPduSessionNotFound
 	}
-	gnbT := gnb.(jsonapi.ControlURI)
-	gnbRan, ok := r.peerMap.Load(gnbT.String())
+	return r.write(rt, pkt)
+}
+
+// WriteEthernet schedules an uplink frame of an Ethernet PDU Session to be sent to the gNB after the one-way delay.
+// This function does not block: the Radio takes ownership of the frame buffer, unless an error is returned.
+func (r *Radio) WriteEthernet(ctx context.Context, frame []byte, src common.MacAddr) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rt, ok := r.routes.Load().macs[src]
 	if !ok {
+		logrus.Trace("PDU Session not found for this MAC Address")
+		return ErrPduSessionNotFound
+	}
+	return r.write(rt, frame)
+}
+
+func (r *Radio) write(rt *route, pkt []byte) error {
+	if !rt.gnbData.IsValid() {
 		logrus.Trace("Unknown gnb")
 		return ErrUnknownGnb
 	}
+	return r.push(r.uplink[flowHash(pkt)%uint32(len(r.uplink))], rt.shapers.uplinkShaper(), rt.imp.uplinkImpairment(), pkt, rt.gnbData, r.delay)
+}
 
-	ctxDelay, cancel := context.WithTimeout(radioCtx, r.delay)
-	defer cancel()
-	select {
-	case <-ctxDelay.Done():
-		select {
-		case <-radioCtx.Done():
-			return radioCtx.Err()
-		default:
-			_, err := srv.WriteToUDPAddrPort(pkt, gnbRan.(netip.AddrPort))
-			return err
+// push shapes the PDU and applies impairments to it, then schedules the resulting copies in the delay queue.
+// On success, the delay queue takes ownership of the pdu buffer, which may be replaced by a smaller one.
+func (r *Radio) push(q *delayQueue, sh *shaper, imp *impairment, pdu []byte, dst netip.AddrPort, delay time.Duration) error {
+	now := time.Now()
+	wait, ok := sh.delay(len(pdu), now)
+	if !ok {
+		return ErrShaperQueueFull
+	}
+	delays, n, err := imp.apply(len(pdu), now.Add(wait), delay)
+	if err != nil {
+		return err
+	}
+	var dup []byte
+	if n == 2 {
+		// each copy is released independently; the copy is made before the queue may release pdu
+		dup = clonePDU(pdu)
+	}
+	// small PDUs must not pin a buffer of the largest size while they are delayed
+	queued, shrunk := shrinkPDU(pdu)
+	if err := q.Push(queued, dst, wait+delays[0]); err != nil {
+		if shrunk {
+			putBuffer(queued)
 		}
-	case <-ctx.Done():
-		return ctx.Err()
+		putBuffer(dup)
+		return err
+	}
+	if shrunk {
+		putBuffer(pdu)
+	}
+	if dup != nil {
+		if err := q.Push(dup, dst, wait+delays[1]); err != nil {
+			putBuffer(dup)
+		}
+	}
+	return nil
+}
+
+// WriteDownlink schedules a downlink PDU received from a gNB to be written on the TUN/TAP interface after the one-way delay.
+// This function does not block: the Radio takes ownership of the pdu buffer, unless an error is returned.
+func (r *Radio) WriteDownlink(pdu []byte, gnbRan netip.AddrPort) error {
+	t := r.routes.Load()
+	imp := t.peers[netip.AddrPortFrom(gnbRan.Addr().Unmap(), gnbRan.Port())].downlinkImpairment()
+	var sh *shaper
+	if rt, ok := t.downlinkRoute(pdu); ok {
+		sh = rt.shapers.downlinkShaper()
 	}
+	return r.push(r.downlink[flowHash(pdu)%uint32(len(r.downlink))], sh, imp, pdu, gnbRan, r.dlDelay)
+}
 
+// Workers returns the number of workers of the data path
+func (r *Radio) Workers() int {
+	return len(r.uplink)
+}
+
+// runDownlink writes delayed downlink PDUs of this worker to the TUN interface,
+// or to the TAP interface (if not nil) for Ethernet PDU Sessions, until ctx is done
+func (r *Radio) runDownlink(ctx context.Context, worker int, ifacetun io.Writer, ifacetap *water.Interface) error {
+	if ifacetun == nil {
+		panic(errNilTunIface)
+	}
+	return r.downlink[worker].Run(ctx, func(batch []delayedPDU) error {
+		var lastErr error
+		for _, item := range batch {
+			var err error
+			if ifacetap != nil && r.routes.Load().isEthernetPDU(item.pdu) {
+				_, err = ifacetap.Write(item.pdu)
+			} else {
+				_, err = ifacetun.Write(item.pdu)
+			}
+			if err != nil {
+				lastErr = err
+			}
+			putBuffer(item.pdu)
+		}
+		return lastErr
+	})
+}
+
+// runUplink sends delayed uplink PDUs of this worker using conn, until ctx is done
+func (r *Radio) runUplink(ctx context.Context, worker int, conn batchConn) error {
+	ms := newMessages(RADIO_BATCH_SIZE)
+	addrs := make(udpAddrCache)
+	return r.uplink[worker].Run(ctx, func(batch []delayedPDU) error {
+		for i, item := range batch {
+			ms[i].Buffers[0] = item.pdu
+			ms[i].Addr = addrs.get(item.dst)
+		}
+		err := writeBatch(conn, ms[:len(batch)])
+		for i, item := range batch {
+			putBuffer(item.pdu)
+			ms[i].Buffers[0] = nil
+		}
+		return err
+	})
 }
 
 func (r *Radio) InitPeer(gnb jsonapi.ControlURI) error {
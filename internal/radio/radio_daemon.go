@@ -7,16 +7,14 @@ package radio
 
 import (
 	"context"
+	"io"
 	"net"
 	"net/netip"
 
-	"github.com/nextmn/ue-lite/internal/tun"
-
 	"github.com/nextmn/json-api/jsonapi"
 
 	"github.com/sirupsen/logrus"
 	"github.com/songgao/water"
-	"github.com/songgao/water/waterutil"
 )
 
 type RadioDaemon struct {
@@ -37,32 +35,46 @@ func NewRadioDaemon(control jsonapi.ControlURI, gnbs []jsonapi.ControlURI, radio
 	}
 }
 
-func (r *RadioDaemon) runDownlinkDaemon(ctx context.Context, srv *net.UDPConn, ifacetun *water.Interface) error {
-	if srv == nil {
-		panic(errNilUdpConn)
-	}
-	if ifacetun == nil {
-		panic(errNilTunIface)
+// runDownlinkDaemon schedules PDUs received from gNBs to be written on the TUN/TAP interface.
+// Several daemons can read the same conn: PDUs are then dispatched to downlink workers by flow,
+// but PDUs of a flow read concurrently by two daemons may be reordered.
+func (r *RadioDaemon) runDownlinkDaemon(ctx context.Context, conn batchConn) error {
+	ms := newMessages(RADIO_BATCH_SIZE)
+	for i := range ms {
+		ms[i].Buffers[0] = getBuffer()
 	}
+	defer func() {
+		for i := range ms {
+			putBuffer(ms[i].Buffers[0])
+		}
+	}()
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			buf := make([]byte, tun.TUN_MTU)
-			n, err := srv.Read(buf)
+			n, err := conn.ReadBatch(ms, 0)
 			if err != nil {
 				return err
 			}
-			ifacetun.Write(buf[:n])
+			for i := range ms[:n] {
+				addr, ok := ms[i].Addr.(*net.UDPAddr)
+				if !ok {
+					continue
+				}
+				pdu := ms[i].Buffers[0][:ms[i].N]
+				if err := r.Radio.WriteDownlink(pdu, addr.AddrPort()); err != nil {
+					logrus.WithError(err).Trace("Packet dropped")
+					continue
+				}
+				// ownership of the buffer has been transferred
+				ms[i].Buffers[0] = getBuffer()
+			}
 		}
 	}
 }
 
-func (r *RadioDaemon) runUplinkDaemon(ctx context.Context, srv *net.UDPConn, ifacetun *water.Interface) error {
-	if srv == nil {
-		panic(errNilUdpConn)
-	}
+func (r *RadioDaemon) runUplinkDaemon(ctx context.Context, ifacetun io.ReadWriter) error {
 	if ifacetun == nil {
 		panic(errNilTunIface)
 	}
@@ -71,44 +83,92 @@ func (r *RadioDaemon) runUplinkDaemon(ctx context.Context, srv *net.UDPConn, ifa
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			if err := r.handleUplinkPDU(ctx, srv, ifacetun); err != nil {
+			if err := r.handleUplinkPDU(ctx, ifacetun); err != nil {
 				logrus.WithError(err).Trace("Packet dropped")
 			}
 		}
 	}
 }
 
-func (r *RadioDaemon) handleUplinkPDU(ctx context.Context, srv *net.UDPConn, ifacetun *water.Interface) error {
-	buf := make([]byte, tun.TUN_MTU)
+func (r *RadioDaemon) handleUplinkPDU(ctx context.Context, ifacetun io.ReadWriter) error {
+	buf := getBuffer()
 	n, err := ifacetun.Read(buf)
 	if err != nil {
+		putBuffer(buf)
 		return err
 	}
 
 	// get UE IP Address
-	if !waterutil.IsIPv4(buf[:n]) {
-		return ErrUnsupportedPDUType
+	src, err := pduSource(buf[:n])
+	if err != nil {
+		putBuffer(buf)
+		return err
+	}
+
+	if err := r.Radio.Write(ctx, buf[:n], src); err != nil {
+		putBuffer(buf)
+		return err
+	}
+	logrus.WithFields(
+		logrus.Fields{
+			"ip-addr": src,
+		}).Trace("Packet forwarded")
+	return nil
+}
+
+// runEthernetUplinkDaemon forwards frames read on the TAP interface to gNBs
+func (r *RadioDaemon) runEthernetUplinkDaemon(ctx context.Context, ifacetap *water.Interface) error {
+	if ifacetap == nil {
+		panic(errNilTapIface)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			if err := r.handleUplinkFrame(ctx, ifacetap); err != nil {
+				logrus.WithError(err).Trace("Frame dropped")
+			}
+		}
 	}
-	src, ok := netip.AddrFromSlice(waterutil.IPv4Source(buf[:n]).To4())
-	if !ok {
-		return ErrMalformedPDU
+}
+
+func (r *RadioDaemon) handleUplinkFrame(ctx context.Context, ifacetap *water.Interface) error {
+	buf := getBuffer()
+	n, err := ifacetap.Read(buf)
+	if err != nil {
+		putBuffer(buf)
+		return err
 	}
 
-	if err := r.Radio.Write(ctx, buf[:n], srv, src); err == nil {
-		logrus.WithFields(
-			logrus.Fields{
-				"ip-addr": src,
-			}).Trace("Packet forwarded")
+	// get source MAC Address
+	src, err := frameSource(buf[:n])
+	if err != nil {
+		putBuffer(buf)
+		return err
 	}
-	return err
 
+	if err := r.Radio.WriteEthernet(ctx, buf[:n], src); err != nil {
+		putBuffer(buf)
+		return err
+	}
+	logrus.WithFields(
+		logrus.Fields{
+			"mac-addr": src,
+		}).Trace("Frame forwarded")
+	return nil
 }
 
 func (r *RadioDaemon) Start(ctx context.Context) error {
 	r.Radio.InitContext(ctx)
+	if err := r.Radio.initImpairments(); err != nil {
+		return err
+	}
 	ifacetun := r.Radio.Tun.OpenTun()
+	ifacetap := r.Radio.Tun.OpenTap()
 	go func(ctx context.Context) error {
 		defer r.Radio.Tun.CloseTun()
+		defer r.Radio.Tun.CloseTap()
 		<-ctx.Done()
 		close(r.closed)
 		return ctx.Err()
@@ -125,16 +185,41 @@ func (r *RadioDaemon) Start(ctx context.Context) error {
 		srv.Close()
 		return ctx.Err()
 	}(ctx, srv)
-	go func(ctx context.Context, srv *net.UDPConn, ifacetun *water.Interface) {
-		if err := r.runDownlinkDaemon(ctx, srv, ifacetun); err != nil {
-			logrus.WithError(err).Error("Radio Downlink Daemon stopped")
-		}
-	}(ctx, srv, ifacetun)
-	go func(ctx context.Context, srv *net.UDPConn, ifacetun *water.Interface) {
-		if err := r.runUplinkDaemon(ctx, srv, ifacetun); err != nil {
-			logrus.WithError(err).Error("Radio Uplink Daemon stopped")
-		}
-	}(ctx, srv, ifacetun)
+	conn := newBatchConn(srv)
+	for worker := range r.Radio.Workers() {
+		go func(ctx context.Context, worker int, conn batchConn) {
+			if err := r.Radio.runUplink(ctx, worker, conn); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"worker": worker}).Error("Radio Uplink Delay Queue stopped")
+			}
+		}(ctx, worker, conn)
+		go func(ctx context.Context, worker int, ifacetun io.ReadWriter, ifacetap *water.Interface) {
+			if err := r.Radio.runDownlink(ctx, worker, ifacetun, ifacetap); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"worker": worker}).Error("Radio Downlink Delay Queue stopped")
+			}
+		}(ctx, worker, ifacetun[worker%len(ifacetun)], ifacetap)
+	}
+	// one reader per worker, so reading from the socket is not a bottleneck
+	for reader := range r.Radio.Workers() {
+		go func(ctx context.Context, reader int, conn batchConn) {
+			if err := r.runDownlinkDaemon(ctx, conn); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"reader": reader}).Error("Radio Downlink Daemon stopped")
+			}
+		}(ctx, reader, conn)
+	}
+	for queue, iface := range ifacetun {
+		go func(ctx context.Context, queue int, ifacetun io.ReadWriter) {
+			if err := r.runUplinkDaemon(ctx, ifacetun); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"queue": queue}).Error("Radio Uplink Daemon stopped")
+			}
+		}(ctx, queue, iface)
+	}
+	if ifacetap != nil {
+		go func(ctx context.Context, ifacetap *water.Interface) {
+			if err := r.runEthernetUplinkDaemon(ctx, ifacetap); err != nil {
+				logrus.WithError(err).Error("Radio Ethernet Uplink Daemon stopped")
+			}
+		}(ctx, ifacetap)
+	}
 
 	for _, gnb := range r.Gnbs {
 		select {
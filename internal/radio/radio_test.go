@@ -0,0 +1,107 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"golang.org/x/net/ipv4"
+)
+
+// discardConn accepts every datagram without sending it
+type discardConn struct{}
+
+func (discardConn) ReadBatch(ms []ipv4.Message, flags int) (int, error) {
+	return 0, nil
+}
+
+func (discardConn) WriteBatch(ms []ipv4.Message, flags int) (int, error) {
+	return len(ms), nil
+}
+
+// newBenchRadio returns a Radio with one IP PDU Session per UE IP Address, all attached to the same gNB.
+// Uplink PDUs are released to a discardConn by one goroutine per worker until ctx is done.
+func newBenchRadio(b *testing.B, ctx context.Context, ueIps []netip.Addr) *Radio {
+	b.Helper()
+	gnb, err := jsonapi.ParseControlURI("http://gnb.example.org")
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := NewRadio(jsonapi.ControlURI{}, nil, 0, 0, netip.MustParseAddrPort("127.0.0.1:2152"), nil, nil, runtime.GOMAXPROCS(0), "")
+	r.InitContext(ctx)
+	if err := r.initImpairments(); err != nil {
+		b.Fatal(err)
+	}
+	if err := r.addPeer(*gnb, netip.MustParseAddrPort("127.0.0.2:2152")); err != nil {
+		b.Fatal(err)
+	}
+	for _, ueIp := range ueIps {
+		if err := r.AddNetnsRoute([]netip.Addr{ueIp}, *gnb); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for worker := range r.Workers() {
+		go r.runUplink(ctx, worker, discardConn{})
+	}
+	return r
+}
+
+// newBenchPacket returns an IPv4/UDP packet of size bytes from src
+func newBenchPacket(src netip.Addr, srcPort uint16, size int) []byte {
+	pkt := make([]byte, size)
+	pkt[0] = 0x45
+	binary.BigEndian.PutUint16(pkt[2:4], uint16(size))
+	pkt[8] = 64
+	pkt[9] = 17 // UDP
+	copy(pkt[12:16], src.AsSlice())
+	copy(pkt[16:20], []byte{10, 0, 0, 1})
+	binary.BigEndian.PutUint16(pkt[20:22], srcPort)
+	binary.BigEndian.PutUint16(pkt[22:24], 5201)
+	binary.BigEndian.PutUint16(pkt[24:26], uint16(size-20))
+	return pkt
+}
+
+func BenchmarkRadioWrite(b *testing.B) {
+	for _, sessions := range []int{1, 16, 256} {
+		b.Run(fmt.Sprintf("sessions=%d", sessions), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ueIps := make([]netip.Addr, sessions)
+			pkts := make([][]byte, sessions)
+			for i := range ueIps {
+				ueIps[i] = netip.AddrFrom4([4]byte{10, 60, byte(i >> 8), byte(i)})
+				pkts[i] = newBenchPacket(ueIps[i], uint16(10000+i), 1400)
+			}
+			r := newBenchRadio(b, ctx, ueIps)
+			var next atomic.Uint64
+			var dropped atomic.Uint64
+			b.SetBytes(1400)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(next.Add(1))
+				for pb.Next() {
+					i++
+					s := i % sessions
+					pkt := clonePDU(pkts[s])
+					if err := r.Write(ctx, pkt, ueIps[s]); err != nil {
+						putBuffer(pkt)
+						dropped.Add(1)
+					}
+				}
+			})
+			b.StopTimer()
+			b.ReportMetric(float64(dropped.Load())/float64(b.N), "drops/op")
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"maps"
+	"net/netip"
+
+	"github.com/nextmn/ue-lite/internal/common"
+
+	"github.com/nextmn/json-api/jsonapi"
+)
+
+// route of a PDU Session; immutable once published in a routingTable
+type route struct {
+	ueIp    netip.Addr   // identifies the PDU Session (IPv4v6: the IPv4 address)
+	ueIps   []netip.Addr // IP PDU Sessions only: all UE IP Addresses, starting with ueIp (IPv4v6: IPv4 and IPv6 addresses)
+	gnb     jsonapi.ControlURI
+	gnbData netip.AddrPort   // not valid while the gNB is not peered
+	imp     *linkImpairments // nil if there is no impairment on the radio link with this gNB
+	shapers *sessionShapers  // nil if there is no Session-AMBR; shared between successive copies of the route
+	macs    []common.MacAddr // Ethernet PDU Sessions only
+	tunAddr bool             // the UE IP Address is configured on the TUN interface
+}
+
+func (rt *route) isEthernet() bool {
+	return rt.macs != nil
+}
+
+// routingTable is a snapshot of the routes used by the data path.
+// It is never modified once published: updates are done on a copy, which then atomically replaces it.
+type routingTable struct {
+	sessions map[netip.Addr]*route               // all PDU Sessions, by the UE IP Address identifying them
+	ips      map[netip.Addr]*route               // IP PDU Sessions, by each of their UE IP Addresses
+	macs     map[common.MacAddr]*route           // Ethernet PDU Sessions, by MAC Address
+	peers    map[netip.AddrPort]*linkImpairments // peered gNBs, by ran address
+	gnbs     map[string]netip.AddrPort           // peered gNBs, by control uri
+}
+
+func newRoutingTable() *routingTable {
+	return &routingTable{
+		sessions: make(map[netip.Addr]*route),
+		ips:      make(map[netip.Addr]*route),
+		macs:     make(map[common.MacAddr]*route),
+		peers:    make(map[netip.AddrPort]*linkImpairments),
+		gnbs:     make(map[string]netip.AddrPort),
+	}
+}
+
+func (t *routingTable) clone() *routingTable {
+	return &routingTable{
+		sessions: maps.Clone(t.sessions),
+		ips:      maps.Clone(t.ips),
+		macs:     maps.Clone(t.macs),
+		peers:    maps.Clone(t.peers),
+		gnbs:     maps.Clone(t.gnbs),
+	}
+}
+
+// store adds or replaces the route of a PDU Session
+func (t *routingTable) store(rt *route) {
+	t.sessions[rt.ueIp] = rt
+	if rt.isEthernet() {
+		for _, mac := range rt.macs {
+			t.macs[mac] = rt
+		}
+		return
+	}
+	for _, ip := range rt.ueIps {
+		t.ips[ip] = rt
+	}
+}
+
+// delete removes the route of a PDU Session
+func (t *routingTable) delete(rt *route) {
+	delete(t.sessions, rt.ueIp)
+	if rt.isEthernet() {
+		for _, mac := range rt.macs {
+			delete(t.macs, mac)
+		}
+		return
+	}
+	for _, ip := range rt.ueIps {
+		delete(t.ips, ip)
+	}
+}
+
+// session returns the route of the PDU Session using this UE IP Address
+func (t *routingTable) session(ueIp netip.Addr) (*route, bool) {
+	if rt, ok := t.sessions[ueIp]; ok {
+		return rt, true
+	}
+	rt, ok := t.ips[ueIp]
+	return rt, ok
+}
+
+// updateRoutes applies f to a copy of the routing table, then publishes the copy if f succeeds.
+// Updates are serialized; readers of the routing table are never blocked.
+func (r *Radio) updateRoutes(f func(t *routingTable) error) error {
+	r.routesMu.Lock()
+	defer r.routesMu.Unlock()
+	t := r.routes.Load().clone()
+	if err := f(t); err != nil {
+		return err
+	}
+	r.routes.Store(t)
+	return nil
+}
+
+// uplinkShaper returns the uplink shaper, or nil if there is none
+func (s *sessionShapers) uplinkShaper() *shaper {
+	if s == nil {
+		return nil
+	}
+	return &s.uplink
+}
+
+// downlinkShaper returns the downlink shaper, or nil if there is none
+func (s *sessionShapers) downlinkShaper() *shaper {
+	if s == nil {
+		return nil
+	}
+	return &s.downlink
+}
+
+// uplinkImpairment returns the uplink impairment, or nil if there is none
+func (l *linkImpairments) uplinkImpairment() *impairment {
+	if l == nil {
+		return nil
+	}
+	return l.uplink
+}
+
+// downlinkImpairment returns the downlink impairment, or nil if there is none
+func (l *linkImpairments) downlinkImpairment() *impairment {
+	if l == nil {
+		return nil
+	}
+	return l.downlink
+}
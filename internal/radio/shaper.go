@@ -0,0 +1,86 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/config"
+	"github.com/nextmn/ue-lite/internal/tun"
+)
+
+const (
+	// Default bucket depth, as duration at the configured rate
+	SHAPER_DEFAULT_BURST = 10 * time.Millisecond
+	// PDUs that would wait longer than this in the shaper are dropped
+	SHAPER_MAX_QUEUING_DELAY = 500 * time.Millisecond
+)
+
+// shaper is a token bucket shaper, implemented as a virtual scheduler:
+// instead of holding PDUs, it computes when each PDU is allowed to leave.
+type shaper struct {
+	mu    sync.Mutex
+	rate  config.Bitrate // 0: no limit
+	burst time.Duration  // bucket depth, as duration at rate
+	tat   time.Time      // theoretical arrival time of the next PDU
+}
+
+// set changes the rate of the shaper
+func (s *shaper) set(rate config.Bitrate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rate = rate
+	s.burst = SHAPER_DEFAULT_BURST
+	if rate > 0 {
+		// the bucket must be able to hold at least one full size PDU
+		s.burst = max(s.burst, time.Duration(float64(tun.TAP_FRAME_MAX*8)/float64(rate)*float64(time.Second)))
+	}
+}
+
+// delay returns the queuing delay of a PDU of this size in the shaper,
+// or false if it must be dropped.
+func (s *shaper) delay(size int, now time.Time) (time.Duration, bool) {
+	if s == nil {
+		return 0, true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rate == 0 {
+		return 0, true
+	}
+	departure := now
+	if early := s.tat.Add(-s.burst); early.After(now) {
+		departure = early
+	}
+	wait := departure.Sub(now)
+	if wait > SHAPER_MAX_QUEUING_DELAY {
+		return 0, false
+	}
+	tx := time.Duration(float64(size*8) / float64(s.rate) * float64(time.Second))
+	if s.tat.Before(now) {
+		s.tat = now
+	}
+	s.tat = s.tat.Add(tx)
+	return wait, true
+}
+
+// sessionShapers limit the bitrate of a PDU Session (Session-AMBR)
+type sessionShapers struct {
+	uplink   shaper
+	downlink shaper
+}
+
+func (s *sessionShapers) Ambr() config.Ambr {
+	s.uplink.mu.Lock()
+	defer s.uplink.mu.Unlock()
+	s.downlink.mu.Lock()
+	defer s.downlink.mu.Unlock()
+	return config.Ambr{
+		Uplink:   s.uplink.rate,
+		Downlink: s.downlink.rate,
+	}
+}
@@ -14,15 +14,15 @@ import (
 )
 
 func (r *Radio) Status(c *gin.Context) {
-	peers := make(map[string]netip.AddrPort)
-	r.peerMap.Range(func(key, value any) bool {
-		peers[key.(string)] = value.(netip.AddrPort)
+	gnbs := r.routes.Load().gnbs
+	peers := make(map[string]netip.AddrPort, len(gnbs))
+	for gnb, data := range gnbs {
+		peers[gnb] = data
 		logrus.WithFields(logrus.Fields{
-			"key":   key.(string),
-			"value": value.(netip.AddrPort),
+			"key":   gnb,
+			"value": data,
 		}).Trace("Creating radio/status response")
-		return true
-	})
+	}
 
 	c.Header("Cache-Control", "no-cache")
 	c.JSON(http.StatusOK, peers)
@@ -0,0 +1,242 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/config"
+)
+
+const (
+	// Number of bytes delivered at each opportunity of a Mahimahi trace
+	MAHIMAHI_OPPORTUNITY_BYTES = 1504
+	// PDUs that would wait longer than this for the trace to deliver them are dropped
+	TRACE_MAX_QUEUING_DELAY = 1 * time.Second
+)
+
+// trace replays a link trace.
+// It is not safe for concurrent use.
+type trace interface {
+	// delay returns the one-way delay of a PDU of this size entering the link at now,
+	// given the configured one-way delay, or false if the PDU must be dropped
+	delay(size int, now time.Time, base time.Duration) (time.Duration, bool)
+}
+
+func loadTrace(conf *config.Trace) (trace, error) {
+	f, err := os.Open(conf.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines := [][]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.Fields(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrEmptyTrace, conf.File)
+	}
+	switch conf.Format {
+	case config.TraceFormatMahimahi:
+		return newMahimahiTrace(lines)
+	case config.TraceFormatDelayBandwidth:
+		return newDelayBandwidthTrace(lines)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTraceFormat, conf.Format)
+	}
+}
+
+func parseMs(s string) (time.Duration, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrMalformedTrace, s)
+	}
+	return time.Duration(v * float64(time.Millisecond)), nil
+}
+
+// mahimahiTrace is a list of delivery opportunities
+type mahimahiTrace struct {
+	opportunities []time.Duration // since the beginning of the trace
+	period        time.Duration
+	start         time.Time
+	cursor        int64 // index of the current opportunity, counting from the start of the first loop
+	bytesLeft     int   // bytes left in the current opportunity
+}
+
+func newMahimahiTrace(lines [][]string) (*mahimahiTrace, error) {
+	t := &mahimahiTrace{
+		opportunities: make([]time.Duration, 0, len(lines)),
+		cursor:        -1,
+	}
+	for _, l := range lines {
+		if len(l) != 1 {
+			return nil, fmt.Errorf("%w: %q", ErrMalformedTrace, strings.Join(l, " "))
+		}
+		o, err := parseMs(l[0])
+		if err != nil {
+			return nil, err
+		}
+		t.opportunities = append(t.opportunities, o)
+	}
+	if !slices.IsSorted(t.opportunities) {
+		return nil, fmt.Errorf("%w: timestamps are not sorted", ErrMalformedTrace)
+	}
+	t.period = t.opportunities[len(t.opportunities)-1]
+	if t.period == 0 {
+		return nil, fmt.Errorf("%w: the trace must last at least 1ms", ErrMalformedTrace)
+	}
+	return t, nil
+}
+
+// at returns the time of the opportunity, since the beginning of the trace
+func (t *mahimahiTrace) at(cursor int64) time.Duration {
+	n := int64(len(t.opportunities))
+	return time.Duration(cursor/n)*t.period + t.opportunities[cursor%n]
+}
+
+// next returns the first opportunity occurring at elapsed or later
+func (t *mahimahiTrace) next(elapsed time.Duration) int64 {
+	n := int64(len(t.opportunities))
+	loop := int64(elapsed / t.period)
+	offset := elapsed % t.period
+	i := int64(sort.Search(len(t.opportunities), func(i int) bool { return t.opportunities[i] >= offset }))
+	return loop*n + i
+}
+
+func (t *mahimahiTrace) delay(size int, now time.Time, base time.Duration) (time.Duration, bool) {
+	if t.start.IsZero() {
+		t.start = now
+	}
+	elapsed := now.Sub(t.start)
+	cursor, bytesLeft := t.cursor, t.bytesLeft
+	if cursor < 0 || t.at(cursor) < elapsed {
+		// unused opportunities are lost
+		cursor = t.next(elapsed)
+		bytesLeft = MAHIMAHI_OPPORTUNITY_BYTES
+	}
+	for size > bytesLeft {
+		size -= bytesLeft
+		cursor++
+		bytesLeft = MAHIMAHI_OPPORTUNITY_BYTES
+	}
+	wait := t.at(cursor) - elapsed
+	if wait > TRACE_MAX_QUEUING_DELAY {
+		return 0, false
+	}
+	t.cursor, t.bytesLeft = cursor, bytesLeft-size
+	return wait + base, true
+}
+
+type delayBandwidthStep struct {
+	at    time.Duration // since the beginning of the trace
+	delay time.Duration
+	rate  config.Bitrate
+}
+
+// delayBandwidthTrace is a list of steps with a constant one-way delay and bandwidth
+type delayBandwidthTrace struct {
+	steps  []delayBandwidthStep
+	period time.Duration // 0 if the trace has a single step
+	start  time.Time
+	tat    time.Duration // theoretical arrival time of the next PDU, since start
+}
+
+func newDelayBandwidthTrace(lines [][]string) (*delayBandwidthTrace, error) {
+	t := &delayBandwidthTrace{
+		steps: make([]delayBandwidthStep, 0, len(lines)),
+	}
+	for _, l := range lines {
+		if len(l) != 3 {
+			return nil, fmt.Errorf("%w: %q", ErrMalformedTrace, strings.Join(l, " "))
+		}
+		at, err := parseMs(l[0])
+		if err != nil {
+			return nil, err
+		}
+		delay, err := parseMs(l[1])
+		if err != nil {
+			return nil, err
+		}
+		kbps, err := strconv.ParseFloat(l[2], 64)
+		if err != nil || kbps < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrMalformedTrace, l[2])
+		}
+		t.steps = append(t.steps, delayBandwidthStep{at: at, delay: delay, rate: config.Bitrate(kbps * 1000)})
+	}
+	if !slices.IsSortedFunc(t.steps, func(a, b delayBandwidthStep) int { return cmp.Compare(a.at, b.at) }) {
+		return nil, fmt.Errorf("%w: timestamps are not sorted", ErrMalformedTrace)
+	}
+	if len(t.steps) > 1 {
+		t.period = t.steps[len(t.steps)-1].at - t.steps[0].at
+		if t.period == 0 {
+			return nil, fmt.Errorf("%w: the trace must last at least 1ms", ErrMalformedTrace)
+		}
+		// the last line only marks the end of the trace
+		t.steps = t.steps[:len(t.steps)-1]
+	}
+	if !slices.ContainsFunc(t.steps, func(s delayBandwidthStep) bool { return s.rate > 0 }) {
+		return nil, fmt.Errorf("%w: the bandwidth is always 0", ErrMalformedTrace)
+	}
+	return t, nil
+}
+
+// step returns the step in use at elapsed, and the time at which this step ends
+func (t *delayBandwidthTrace) step(elapsed time.Duration) (delayBandwidthStep, time.Duration) {
+	if t.period == 0 {
+		return t.steps[0], time.Duration(1<<63 - 1)
+	}
+	offset := t.steps[0].at
+	loop := (elapsed - offset) / t.period
+	if (elapsed-offset)%t.period < 0 {
+		loop--
+	}
+	pos := elapsed - loop*t.period
+	i := sort.Search(len(t.steps), func(i int) bool { return t.steps[i].at > pos }) - 1
+	end := loop*t.period + offset + t.period
+	if i+1 < len(t.steps) {
+		end = loop*t.period + t.steps[i+1].at
+	}
+	return t.steps[i], end
+}
+
+func (t *delayBandwidthTrace) delay(size int, now time.Time, base time.Duration) (time.Duration, bool) {
+	if t.start.IsZero() {
+		t.start = now
+	}
+	elapsed := now.Sub(t.start)
+	departure := max(elapsed, t.tat)
+	s, end := t.step(departure)
+	for s.rate == 0 {
+		// link interrupted: wait for the next step
+		departure = end
+		if departure-elapsed > TRACE_MAX_QUEUING_DELAY {
+			return 0, false
+		}
+		s, end = t.step(departure)
+	}
+	wait := departure - elapsed
+	if wait > TRACE_MAX_QUEUING_DELAY {
+		return 0, false
+	}
+	t.tat = departure + time.Duration(float64(size*8)/float64(s.rate)*float64(time.Second))
+	return wait + s.delay, true
+}
@@ -0,0 +1,14 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import "errors"
+
+var (
+	ErrNoPduSessionForDnn = errors.New("no PDU Session found for this DNN")
+
+	ErrUnexpectedAddressFamily = errors.New("the UE IP Addresses are not of the address families of the PDU Session Type")
+)
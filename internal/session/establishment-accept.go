@@ -7,6 +7,7 @@ package session
 
 import (
 	"net/http"
+	"net/netip"
 
 	"github.com/nextmn/json-api/jsonapi"
 	"github.com/nextmn/json-api/jsonapi/n1n2"
@@ -15,9 +16,24 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// PduSessionEstabAcceptMsg is a PDU Session Establishment Accept;
+// for IPv4v6 PDU Sessions, Addr is the IPv4 address and Addr6 is the IPv6 address.
+type PduSessionEstabAcceptMsg struct {
+	n1n2.PduSessionEstabAcceptMsg
+	Addr6 netip.Addr `json:"address-ipv6,omitempty"` // IPv4v6 PDU Sessions only
+}
+
+// Addrs returns the UE IP Addresses of the PDU Session
+func (m PduSessionEstabAcceptMsg) Addrs() []netip.Addr {
+	if m.Addr6.IsValid() {
+		return []netip.Addr{m.Addr, m.Addr6}
+	}
+	return []netip.Addr{m.Addr}
+}
+
 // get status of the controller
 func (p *PduSessions) EstablishmentAccept(c *gin.Context) {
-	var ps n1n2.PduSessionEstabAcceptMsg
+	var ps PduSessionEstabAcceptMsg
 	if err := c.BindJSON(&ps); err != nil {
 		logrus.WithError(err).Error("could not deserialize")
 		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
@@ -26,10 +42,25 @@ func (p *PduSessions) EstablishmentAccept(c *gin.Context) {
 
 	logrus.WithFields(logrus.Fields{
 		"gnb":     ps.Header.Gnb.String(),
-		"ip-addr": ps.Addr,
+		"ip-addr": ps.Addrs(),
+		"dnn":     ps.Header.Dnn,
 	}).Info("New PDU Session")
 
-	go p.CreatePduSession(ps.Addr, ps.Header.Gnb)
+	go p.HandleEstablishmentAccept(ps)
 
 	c.JSON(http.StatusAccepted, jsonapi.Message{Message: "please refer to logs for more information"})
 }
+
+func (p *PduSessions) HandleEstablishmentAccept(m PduSessionEstabAcceptMsg) {
+	if err := p.waitDownlinkDelay(p.Context()); err != nil {
+		logrus.WithError(err).Error("Context was done before processing ps/establishment-accept")
+		return
+	}
+	if err := p.CreatePduSession(m.Addrs(), m.Header.Gnb, m.Header.Dnn); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"gnb":     m.Header.Gnb.String(),
+			"ip-addr": m.Addrs(),
+			"dnn":     m.Header.Dnn,
+		}).Error("Could not create PDU Session")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"net/netip"
 
 	"github.com/nextmn/json-api/jsonapi"
 	"github.com/nextmn/json-api/jsonapi/n1n2"
@@ -38,6 +39,24 @@ func (p *PduSessions) HandoverCommand(c *gin.Context) {
 
 func (p *PduSessions) HandleHandoverCommand(m n1n2.HandoverCommand) {
 	ctx := p.Context()
+
+	// measure the interruption of traffic, from the reception of the command to the confirmation
+	addrs := make([]netip.Addr, 0, len(m.Sessions))
+	for _, session := range m.Sessions {
+		addrs = append(addrs, session.Addr)
+	}
+	handovers := p.startHandoverProbes(addrs, m.SourceGnb, m.TargetGnb)
+	updated := make(map[netip.Addr]bool, len(m.Sessions))
+	defer func() {
+		for ip, h := range handovers {
+			h.Done(ctx, updated[ip])
+		}
+	}()
+
+	if err := p.waitDownlinkDelay(ctx); err != nil {
+		logrus.WithError(err).Error("Context was done before processing ps/handover-command")
+		return
+	}
 	if m.SourceGnb == m.TargetGnb {
 		logrus.WithFields(logrus.Fields{
 			"gnb": m.SourceGnb.String(),
@@ -58,6 +77,7 @@ func (p *PduSessions) HandleHandoverCommand(m n1n2.HandoverCommand) {
 			}).Error("Handover failure")
 			continue
 		}
+		updated[session.Addr.Unmap()] = true
 		sessions[i] = n1n2.Session{
 			Addr: session.Addr,
 			Dnn:  session.Dnn,
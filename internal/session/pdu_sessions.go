@@ -9,8 +9,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/netip"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/nextmn/ue-lite/internal/common"
@@ -32,10 +35,16 @@ type PduSessions struct {
 	UserAgent string
 	reqPs     []config.PDUSession
 	radio     *radio.Radio
-	delay     time.Duration
+	delay     time.Duration // uplink one-way delay for control messages
+	dlDelay   time.Duration // downlink one-way delay for control messages
+
+	mu      sync.Mutex
+	dnns    map[netip.Addr]string         // key: each UE IP Address of the PDU Session; value: DNN of the PDU Session
+	proxies map[netip.Addr]sessionProxies // key: UE IP Address identifying the PDU Session
+	probes  map[netip.Addr]sessionProbe   // key: UE IP Address identifying the PDU Session
 }
 
-func NewPduSessions(control jsonapi.ControlURI, r *radio.Radio, delay time.Duration, reqPs []config.PDUSession, userAgent string) *PduSessions {
+func NewPduSessions(control jsonapi.ControlURI, r *radio.Radio, delay time.Duration, dlDelay time.Duration, reqPs []config.PDUSession, userAgent string) *PduSessions {
 	return &PduSessions{
 		Client:    http.Client{},
 		Control:   control,
@@ -43,13 +52,19 @@ func NewPduSessions(control jsonapi.ControlURI, r *radio.Radio, delay time.Durat
 		reqPs:     reqPs,
 		radio:     r,
 		delay:     delay,
+		dlDelay:   dlDelay,
+		dnns:      make(map[netip.Addr]string),
+		proxies:   make(map[netip.Addr]sessionProxies),
+		probes:    make(map[netip.Addr]sessionProbe),
 	}
 }
 
 func (p *PduSessions) Register(e *gin.Engine) {
 	e.GET("/ps", p.Status)
+	e.GET("/ps/details", p.Details)
 	e.POST("/ps/establishment-accept", p.EstablishmentAccept)
 	e.POST("/ps/handover-command", p.HandoverCommand)
+	e.GET("/ps/probes", p.ProbesStatus)
 }
 
 func (p *PduSessions) InitEstablish(gnb jsonapi.ControlURI, dnn string) error {
@@ -92,6 +107,21 @@ func (p *PduSessions) InitEstablish(gnb jsonapi.ControlURI, dnn string) error {
 	}
 }
 
+// waitDownlinkDelay emulates the one-way delay of a control message received from a gNB
+func (p *PduSessions) waitDownlinkDelay(ctx context.Context) error {
+	if p.dlDelay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(p.dlDelay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 func (p *PduSessions) Start(ctx context.Context) error {
 	p.InitContext(ctx)
 	logrus.WithFields(logrus.Fields{
@@ -112,11 +142,58 @@ func (p *PduSessions) WaitShutdown(ctx context.Context) error {
 	return nil
 }
 
+// DeletePduSession removes the PDU Session using this UE IP Address
 func (p *PduSessions) DeletePduSession(ueIpAddr netip.Addr) error {
+	return p.deletePduSession(p.sessionAddrs(ueIpAddr))
+}
+
+// deletePduSession removes the PDU Session with these UE IP Addresses, starting with the one identifying it
+func (p *PduSessions) deletePduSession(ueIpAddrs []netip.Addr) error {
 	logrus.WithFields(logrus.Fields{
-		"ue-ip-addr": ueIpAddr,
+		"ue-ip-addr": ueIpAddrs,
 	}).Debug("Removing PDU Session")
-	return p.radio.DelRoute(ueIpAddr)
+	p.stopProbe(ueIpAddrs[0])
+	p.stopProxies(ueIpAddrs[0])
+	p.mu.Lock()
+	for _, ip := range ueIpAddrs {
+		delete(p.dnns, ip)
+	}
+	p.mu.Unlock()
+	// every step is run, even if a previous one failed, since this is also used to roll back a partially created PDU Session
+	var errs []error
+	for _, ip := range ueIpAddrs {
+		errs = append(errs,
+			p.radio.Tun.DelSessionRoutes(p.Context(), ip),
+			p.radio.Tun.DelSessionNetns(p.Context(), ip),
+			p.radio.Tun.DelSessionRouting(p.Context(), ip),
+		)
+	}
+	errs = append(errs, p.radio.DelRoute(ueIpAddrs[0]))
+	return errors.Join(errs...)
+}
+
+// sessionAddrs returns the UE IP Addresses of the PDU Session using this UE IP Address, starting with the one identifying it
+func (p *PduSessions) sessionAddrs(ueIpAddr netip.Addr) []netip.Addr {
+	if addrs, ok := p.radio.SessionAddrs(ueIpAddr); ok {
+		return addrs
+	}
+	return []netip.Addr{ueIpAddr.Unmap()}
+}
+
+// SourceAddr returns the UE IP Address of the PDU Session using ueIpAddr to be used as source towards dst:
+// for IPv4v6 PDU Sessions, this is the UE IP Address of the address family of dst.
+func (p *PduSessions) SourceAddr(ueIpAddr netip.Addr, dst netip.Addr) netip.Addr {
+	return sourceAddr(p.sessionAddrs(ueIpAddr), dst)
+}
+
+// sourceAddr returns the address of the address family of dst, or else the first address
+func sourceAddr(ueIpAddrs []netip.Addr, dst netip.Addr) netip.Addr {
+	for _, ip := range ueIpAddrs {
+		if ip.Is4() == dst.Unmap().Is4() {
+			return ip
+		}
+	}
+	return ueIpAddrs[0]
 }
 
 func (p *PduSessions) UpdatePduSession(ueIpAddr netip.Addr, oldGnb jsonapi.ControlURI, newGnb jsonapi.ControlURI) error {
@@ -125,12 +202,165 @@ func (p *PduSessions) UpdatePduSession(ueIpAddr netip.Addr, oldGnb jsonapi.Contr
 		"old-gnb":    oldGnb.String(),
 		"new-gnb":    newGnb.String(),
 	}).Info("Updating PDU Session")
-	return p.radio.UpdateRoute(ueIpAddr, oldGnb, newGnb)
+	if err := p.radio.UpdateRoute(ueIpAddr, oldGnb, newGnb); err != nil {
+		return err
+	}
+	for _, ip := range p.sessionAddrs(ueIpAddr) {
+		if err := p.radio.Tun.RefreshSessionRoutes(p.Context(), ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessionConfig returns the configuration of the requested PDU Session using this DNN
+func (p *PduSessions) sessionConfig(dnn string) (config.PDUSession, bool) {
+	for _, ps := range p.reqPs {
+		if ps.Dnn == dnn {
+			return ps, true
+		}
+	}
+	return config.PDUSession{}, false
 }
 
-func (p *PduSessions) CreatePduSession(ueIpAddr netip.Addr, gnb jsonapi.ControlURI) error {
+// checkAddrs checks the UE IP Addresses match this PDU Session Type (if set):
+// IPv4v6 PDU Sessions have an IPv4 address then an IPv6 address, and other PDU Sessions have a single address.
+func checkAddrs(psType config.PDUSessionType, ueIpAddrs []netip.Addr) error {
+	switch {
+	case len(ueIpAddrs) == 2:
+		if (psType != "" && psType != config.PDUSessionTypeIPv4v6) || !ueIpAddrs[0].Is4() || !ueIpAddrs[1].Is6() {
+			return ErrUnexpectedAddressFamily
+		}
+	case len(ueIpAddrs) != 1, psType == config.PDUSessionTypeIPv4v6:
+		return ErrUnexpectedAddressFamily
+	case psType == config.PDUSessionTypeIPv4 && !ueIpAddrs[0].Is4(),
+		psType == config.PDUSessionTypeIPv6 && !ueIpAddrs[0].Is6():
+		return ErrUnexpectedAddressFamily
+	}
+	return nil
+}
+
+// CreatePduSession creates a PDU Session with these UE IP Addresses;
+// the first one identifies the PDU Session (IPv4v6 PDU Sessions: the IPv4 address, followed by the IPv6 address)
+func (p *PduSessions) CreatePduSession(ueIpAddrs []netip.Addr, gnb jsonapi.ControlURI, dnn string) error {
 	logrus.WithFields(logrus.Fields{
-		"ue-ip-addr": ueIpAddr,
+		"ue-ip-addr": ueIpAddrs,
+		"dnn":        dnn,
 	}).Debug("Creating new PDU Session")
-	return p.radio.AddRoute(ueIpAddr, gnb)
+	conf, ok := p.sessionConfig(dnn)
+	ueIpAddrs = slices.Clone(ueIpAddrs)
+	for i, ip := range ueIpAddrs {
+		ueIpAddrs[i] = ip.Unmap()
+	}
+	if err := checkAddrs(conf.Type, ueIpAddrs); err != nil {
+		return err
+	}
+	ueIpAddr := ueIpAddrs[0]
+	if ok && conf.IsEthernet() {
+		macs := conf.Macs
+		if len(macs) == 0 {
+			mac, err := p.radio.Tun.TapHardwareAddr()
+			if err != nil {
+				return err
+			}
+			macs = []common.MacAddr{mac}
+		}
+		if err := p.radio.AddEthernetRoute(ueIpAddr, macs, gnb); err != nil {
+			return err
+		}
+	} else if err := p.createIpPduSession(ueIpAddrs, gnb, conf); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	for _, ip := range ueIpAddrs {
+		p.dnns[ip] = dnn
+	}
+	p.mu.Unlock()
+	if conf.Ambr != (config.Ambr{}) {
+		return p.radio.SetAmbr(ueIpAddr, conf.Ambr)
+	}
+	return nil
+}
+
+// SessionDnn returns the DNN of the PDU Session using this UE IP Address
+func (p *PduSessions) SessionDnn(ueIpAddr netip.Addr) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dnn, ok := p.dnns[ueIpAddr.Unmap()]
+	return dnn, ok
+}
+
+// Lookup returns the UE IP Address and DNN of a PDU Session, selected by its UE IP Address if valid, or else by its DNN
+func (p *PduSessions) Lookup(dnn string, ueIpAddr netip.Addr) (netip.Addr, string, error) {
+	if ueIpAddr.IsValid() {
+		dnn, ok := p.SessionDnn(ueIpAddr)
+		if !ok {
+			return netip.Addr{}, "", radio.ErrPduSessionNotFound
+		}
+		return ueIpAddr.Unmap(), dnn, nil
+	}
+	ip, ok := p.SessionAddr(dnn)
+	if !ok {
+		return netip.Addr{}, "", ErrNoPduSessionForDnn
+	}
+	return ip, dnn, nil
+}
+
+// SessionAddr returns the UE IP Address of a PDU Session using this DNN;
+// IPv4 is preferred when several PDU Sessions use this DNN.
+func (p *PduSessions) SessionAddr(dnn string) (netip.Addr, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var found netip.Addr
+	for ip, d := range p.dnns {
+		if d != dnn {
+			continue
+		}
+		if !found.IsValid() || (ip.Is4() && !found.Is4()) || (ip.Is4() == found.Is4() && ip.Less(found)) {
+			found = ip
+		}
+	}
+	return found, found.IsValid()
+}
+
+// createIpPduSession routes this IP PDU Session through the TUN interface, or through its network namespace;
+// each UE IP Address has its own routing table and rule
+func (p *PduSessions) createIpPduSession(ueIpAddrs []netip.Addr, gnb jsonapi.ControlURI, conf config.PDUSession) error {
+	if conf.Netns != "" {
+		if err := p.radio.AddNetnsRoute(ueIpAddrs, gnb); err != nil {
+			return err
+		}
+	} else if err := p.radio.AddRoute(ueIpAddrs, gnb); err != nil {
+		return err
+	}
+	var err error
+	for _, ip := range ueIpAddrs {
+		if err = p.radio.Tun.AddSessionRouting(p.Context(), ip); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		if conf.Netns != "" {
+			err = p.radio.Tun.AddSessionNetns(p.Context(), ueIpAddrs, conf.Netns)
+		} else {
+			for _, ip := range ueIpAddrs {
+				if err = p.radio.Tun.AddSessionRoutes(p.Context(), ip, conf.Destinations(ip)); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err == nil {
+		err = p.startProxies(ueIpAddrs, conf)
+	}
+	if err == nil {
+		err = p.startProbe(ueIpAddrs, conf)
+	}
+	if err != nil {
+		if err := p.deletePduSession(ueIpAddrs); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"ue-ip-addr": ueIpAddrs}).Error("Could not remove PDU Session")
+		}
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,102 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+
+	"github.com/nextmn/ue-lite/internal/config"
+	"github.com/nextmn/ue-lite/internal/probe"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// sessionProbe is the latency probe of a PDU Session
+type sessionProbe struct {
+	probe  *probe.Probe
+	cancel context.CancelFunc
+}
+
+// startProbe starts the latency probe of this PDU Session, if any
+func (p *PduSessions) startProbe(ueIpAddrs []netip.Addr, conf config.PDUSession) error {
+	if conf.Probe == nil {
+		return nil
+	}
+	ueIpAddr := ueIpAddrs[0]
+	dial := func(ctx context.Context, network string, dst netip.AddrPort) (net.Conn, error) {
+		return p.radio.Tun.DialContext(ctx, network, sourceAddr(ueIpAddrs, dst.Addr()), dst)
+	}
+	pr, err := probe.NewProbe(ueIpAddrs, *conf.Probe, dial)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"ue-ip-addr": ueIpAddrs}).Error("Invalid probe for PDU Session")
+		return err
+	}
+	ctx, cancel := context.WithCancel(p.Context())
+	if err := pr.Start(ctx); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"ue-ip-addr": ueIpAddr,
+			"target":     conf.Probe.Target,
+		}).Error("Could not start probe for PDU Session")
+		cancel()
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.probes[ueIpAddr] = sessionProbe{
+		probe:  pr,
+		cancel: cancel,
+	}
+	return nil
+}
+
+// stopProbe stops the latency probe of this PDU Session, if any
+func (p *PduSessions) stopProbe(ueIpAddr netip.Addr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if sp, ok := p.probes[ueIpAddr.Unmap()]; ok {
+		sp.cancel()
+		delete(p.probes, ueIpAddr.Unmap())
+	}
+}
+
+// startHandoverProbes starts the measurement of a handover by the probes of these PDU Sessions;
+// key of the returned map: UE IP Address
+func (p *PduSessions) startHandoverProbes(ueIpAddrs []netip.Addr, sourceGnb jsonapi.ControlURI, targetGnb jsonapi.ControlURI) map[netip.Addr]*probe.Handover {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	handovers := make(map[netip.Addr]*probe.Handover)
+	for _, ip := range ueIpAddrs {
+		if sp, ok := p.probes[ip.Unmap()]; ok {
+			handovers[ip.Unmap()] = sp.probe.Handover(sourceGnb, targetGnb)
+		}
+	}
+	return handovers
+}
+
+// ProbesStatus returns the status of latency probes, including their handover reports
+func (p *PduSessions) ProbesStatus(c *gin.Context) {
+	p.mu.Lock()
+	probes := make([]*probe.Probe, 0, len(p.probes))
+	for _, sp := range p.probes {
+		probes = append(probes, sp.probe)
+	}
+	p.mu.Unlock()
+	status := make([]probe.ProbeStatus, 0, len(probes))
+	for _, pr := range probes {
+		status = append(status, pr.Status())
+	}
+	slices.SortFunc(status, func(a, b probe.ProbeStatus) int { return a.UeIpAddr.Compare(b.UeIpAddr) })
+
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, status)
+}
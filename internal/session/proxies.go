@@ -0,0 +1,82 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"net"
+	"net/netip"
+
+	"github.com/nextmn/ue-lite/internal/config"
+	"github.com/nextmn/ue-lite/internal/proxy"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sessionProxies are the local proxies of a PDU Session
+type sessionProxies struct {
+	forwards []config.Forward
+	socks5   netip.AddrPort // listen address of the SOCKS5 server, if any
+	cancel   context.CancelFunc
+}
+
+// startProxies starts the local proxies of this PDU Session, using the UE IP Address of the address family of each destination as source
+func (p *PduSessions) startProxies(ueIpAddrs []netip.Addr, conf config.PDUSession) error {
+	if len(conf.Forwards) == 0 && !conf.Socks5.IsValid() {
+		return nil
+	}
+	ueIpAddr := ueIpAddrs[0]
+	ctx, cancel := context.WithCancel(p.Context())
+	dial := func(ctx context.Context, network string, dst netip.AddrPort) (net.Conn, error) {
+		return p.radio.Tun.DialContext(ctx, network, sourceAddr(ueIpAddrs, dst.Addr()), dst)
+	}
+	for _, fwd := range conf.Forwards {
+		if err := proxy.NewForwarder(fwd, dial).Start(ctx); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue-ip-addr": ueIpAddrs,
+				"listen":     fwd.Listen,
+			}).Error("Could not start forwarder for PDU Session")
+			cancel()
+			return err
+		}
+	}
+	if conf.Socks5.IsValid() {
+		if err := proxy.NewSocks5Server(conf.Socks5, dial, conf.Socks5Dns).Start(ctx); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue-ip-addr": ueIpAddrs,
+				"listen":     conf.Socks5,
+			}).Error("Could not start SOCKS5 server for PDU Session")
+			cancel()
+			return err
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.proxies[ueIpAddr] = sessionProxies{
+		forwards: conf.Forwards,
+		socks5:   conf.Socks5,
+		cancel:   cancel,
+	}
+	return nil
+}
+
+// stopProxies stops the local proxies of this PDU Session, if any
+func (p *PduSessions) stopProxies(ueIpAddr netip.Addr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if px, ok := p.proxies[ueIpAddr.Unmap()]; ok {
+		px.cancel()
+		delete(p.proxies, ueIpAddr.Unmap())
+	}
+}
+
+// getProxies returns the local proxies of this PDU Session
+func (p *PduSessions) getProxies(ueIpAddr netip.Addr) (sessionProxies, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	px, ok := p.proxies[ueIpAddr.Unmap()]
+	return px, ok
+}
@@ -7,13 +7,53 @@ package session
 
 import (
 	"net/http"
+	"net/netip"
+
+	"github.com/nextmn/ue-lite/internal/config"
+
+	"github.com/nextmn/json-api/jsonapi"
 
 	"github.com/gin-gonic/gin"
 )
 
+// PduSessionStatus contains the details of a PDU Session
+type PduSessionStatus struct {
+	Gnb      jsonapi.ControlURI `json:"gnb"`
+	Dnn      string             `json:"dnn,omitempty"`
+	Netns    string             `json:"netns,omitempty"`    // network namespace of the PDU Session, if any
+	Forwards []config.Forward   `json:"forwards,omitempty"` // local proxies of the PDU Session
+	Socks5   string             `json:"socks5,omitempty"`   // listen address of the SOCKS5 server of the PDU Session, if any
+}
+
 func (p *PduSessions) Status(c *gin.Context) {
 	sessions := p.radio.GetRoutes()
 
 	c.Header("Cache-Control", "no-cache")
 	c.JSON(http.StatusOK, sessions)
 }
+
+// Details returns the details of PDU Sessions (gNB, DNN, network namespace, local proxies)
+func (p *PduSessions) Details(c *gin.Context) {
+	routes := p.radio.GetRoutes()
+	sessions := make(map[netip.Addr]PduSessionStatus, len(routes))
+	for ueIp, gnb := range routes {
+		status := PduSessionStatus{Gnb: gnb}
+		if dnn, ok := p.SessionDnn(ueIp); ok {
+			status.Dnn = dnn
+		}
+		if netns, ok := p.radio.Tun.SessionNetns(ueIp); ok {
+			status.Netns = netns
+		}
+		// local proxies belong to the UE IP Address identifying the PDU Session
+		if px, ok := p.getProxies(p.sessionAddrs(ueIp)[0]); ok {
+			status.Forwards = px.forwards
+			if px.socks5.IsValid() {
+				status.Socks5 = px.socks5.String()
+			}
+		}
+		sessions[ueIp] = status
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, sessions)
+}
@@ -0,0 +1,100 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package traffic
+
+import (
+	"cmp"
+	"net/netip"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/common"
+	"github.com/nextmn/ue-lite/internal/config"
+	"github.com/nextmn/ue-lite/internal/echo"
+	"github.com/nextmn/ue-lite/internal/tun"
+)
+
+const (
+	// Default size of packets, IP header included
+	DEFAULT_SIZE = 1000
+
+	// Default number of packets per burst
+	DEFAULT_BURST = 10
+
+	// Default delay after which an unanswered packet is lost
+	DEFAULT_TIMEOUT = time.Second
+)
+
+type Protocol string
+
+const (
+	ProtocolUdp  Protocol = "udp"
+	ProtocolIcmp Protocol = "icmp"
+)
+
+type Pattern string
+
+const (
+	PatternCbr     Pattern = "cbr"     // constant bitrate
+	PatternBursty  Pattern = "bursty"  // bursts of packets sent back-to-back
+	PatternPoisson Pattern = "poisson" // exponential inter-arrival times
+)
+
+// FlowConfig describes a flow sent from the UE IP Address of a PDU Session to a target in the Data Network
+type FlowConfig struct {
+	Dnn  string     `json:"dnn,omitempty"`     // DNN of the PDU Session
+	Addr netip.Addr `json:"address,omitempty"` // UE IP Address of the PDU Session (instead of the DNN)
+
+	Protocol Protocol `json:"protocol"` // udp (the target must echo datagrams back) or icmp (echo requests)
+	Target   string   `json:"target"`   // udp: `ip:port`; icmp: `ip`
+
+	Pattern  Pattern         `json:"pattern,omitempty"`  // cbr (default), bursty or poisson
+	Rate     config.Bitrate  `json:"rate"`               // mean bitrate, IP headers included
+	Size     int             `json:"size,omitempty"`     // size of packets, IP header included (default: 1000)
+	Burst    int             `json:"burst,omitempty"`    // bursty only: number of packets per burst (default: 10)
+	Duration common.Duration `json:"duration,omitempty"` // the flow stops after this duration (default: when stopped)
+	Timeout  common.Duration `json:"timeout,omitempty"`  // packets not answered after this delay are lost (default: 1s)
+}
+
+// withDefaults returns the configuration with default values set
+func (c FlowConfig) withDefaults() FlowConfig {
+	c.Pattern = cmp.Or(c.Pattern, PatternCbr)
+	c.Size = cmp.Or(c.Size, DEFAULT_SIZE)
+	c.Burst = cmp.Or(c.Burst, DEFAULT_BURST)
+	c.Timeout = cmp.Or(c.Timeout, common.Duration(DEFAULT_TIMEOUT))
+	return c
+}
+
+// target returns the target of the flow
+func (c FlowConfig) target() (netip.AddrPort, error) {
+	return echo.ParseTarget(c.Target, c.Protocol == ProtocolIcmp)
+}
+
+// validate checks the configuration (with defaults set) can be used from this UE IP Address
+func (c FlowConfig) validate(ueIp netip.Addr, target netip.AddrPort) error {
+	switch c.Protocol {
+	case ProtocolUdp, ProtocolIcmp:
+	default:
+		return ErrUnknownProtocol
+	}
+	switch c.Pattern {
+	case PatternCbr, PatternBursty, PatternPoisson:
+	default:
+		return ErrUnknownPattern
+	}
+	if target.Addr().Is4() != ueIp.Is4() {
+		return ErrAddressFamily
+	}
+	if c.Rate == 0 {
+		return ErrInvalidRate
+	}
+	if c.Size-echo.HeadersLen(c.Protocol == ProtocolIcmp, ueIp) < echo.PAYLOAD_LEN || c.Size > tun.TUN_MTU_MAX {
+		return ErrInvalidSize
+	}
+	if c.Burst < 1 || c.Timeout <= 0 || c.Duration < 0 {
+		return ErrInvalidConfig
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package traffic
+
+import "errors"
+
+var (
+	ErrUnknownProtocol = errors.New("unknown protocol: use udp or icmp")
+	ErrUnknownPattern  = errors.New("unknown pattern: use cbr, bursty or poisson")
+	ErrAddressFamily   = errors.New("the target is not of the address family of the PDU Session")
+	ErrInvalidRate     = errors.New("invalid rate")
+	ErrInvalidSize     = errors.New("invalid packet size")
+	ErrInvalidConfig   = errors.New("invalid burst, duration or timeout")
+	ErrFlowNotFound    = errors.New("no flow found with this id")
+)
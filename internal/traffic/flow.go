@@ -0,0 +1,215 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package traffic
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/echo"
+
+	"github.com/sirupsen/logrus"
+)
+
+type FlowStatus struct {
+	Id       uint32     `json:"id"`
+	UeIpAddr netip.Addr `json:"ue-ip-addr"`
+	Config   FlowConfig `json:"config"`
+	Running  bool       `json:"running"`
+	Start    time.Time  `json:"start"`
+
+	Sent       uint64           `json:"sent"`
+	Received   uint64           `json:"received"`
+	Lost       uint64           `json:"lost"`        // packets not answered before the timeout
+	SendErrors uint64           `json:"send-errors"` // packets that could not be sent
+	Latency    echo.DelayStatus `json:"latency"`     // round-trip time
+}
+
+// flow sends packets from a UE IP Address, and receives the answers of the target
+type flow struct {
+	id      uint32
+	ueIp    netip.Addr
+	conf    FlowConfig
+	conn    *echo.Conn
+	cancel  context.CancelFunc
+	closing atomic.Bool // the connection is being closed
+	done    chan struct{}
+
+	mu         sync.Mutex
+	pending    *echo.Pending
+	stopped    time.Time // when the flow was done
+	sent       uint64
+	received   uint64
+	sendErrors uint64
+	rtt        echo.DelayStats
+}
+
+func newFlow(id uint32, ueIp netip.Addr, conf FlowConfig, conn *echo.Conn) *flow {
+	return &flow{
+		id:      id,
+		ueIp:    ueIp,
+		conf:    conf,
+		conn:    conn,
+		done:    make(chan struct{}),
+		pending: echo.NewPending(),
+	}
+}
+
+// run sends packets until ctx is done (or the duration of the flow is elapsed), then waits for the last answers
+func (f *flow) run(ctx context.Context) {
+	defer close(f.done)
+	if f.conf.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(f.conf.Duration))
+		defer cancel()
+	}
+	go f.receive()
+	go echo.RunLossCheck(ctx, f.checkLoss)
+	f.send(ctx)
+
+	// wait for answers to the last packets
+	timer := time.NewTimer(time.Duration(f.conf.Timeout))
+	defer timer.Stop()
+	<-timer.C
+	f.closing.Store(true)
+	f.conn.Close()
+	f.mu.Lock()
+	f.pending.ExpireAll()
+	f.stopped = time.Now()
+	f.mu.Unlock()
+}
+
+// interval returns the mean interval between packets
+func (f *flow) interval() time.Duration {
+	return time.Duration(float64(f.conf.Size*8) / float64(f.conf.Rate) * float64(time.Second))
+}
+
+// send sends packets following the pattern of the flow until ctx is done;
+// when late, packets are sent immediately to keep the mean bitrate.
+func (f *flow) send(ctx context.Context) {
+	interval := f.interval()
+	next := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for seq := uint64(0); ; {
+		if d := time.Until(next); d > 0 {
+			timer.Reset(d)
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+		switch f.conf.Pattern {
+		case PatternBursty:
+			for range f.conf.Burst {
+				f.sendPacket(seq)
+				seq++
+			}
+			next = next.Add(interval * time.Duration(f.conf.Burst))
+		case PatternPoisson:
+			f.sendPacket(seq)
+			seq++
+			next = next.Add(time.Duration(rand.ExpFloat64() * float64(interval)))
+		default:
+			f.sendPacket(seq)
+			seq++
+			next = next.Add(interval)
+		}
+	}
+}
+
+// sendPacket sends a packet with this sequence number
+func (f *flow) sendPacket(seq uint64) {
+	// registered before sending, so a fast answer is not ignored
+	f.mu.Lock()
+	f.pending.Add(seq, f.conn.Elapsed())
+	f.mu.Unlock()
+	if _, err := f.conn.Send(seq); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"flow": f.id}).Trace("Could not send packet")
+		f.mu.Lock()
+		f.pending.Remove(seq)
+		f.sendErrors++
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Lock()
+	f.sent++
+	f.mu.Unlock()
+}
+
+// receive reads answers of the target until the connection is closed
+func (f *flow) receive() {
+	for {
+		seq, _, rtt, err := f.conn.Receive()
+		if err != nil {
+			if f.closing.Load() {
+				return
+			}
+			// e.g. ICMP errors reported on the socket, or packets of other flows
+			if !errors.Is(err, echo.ErrInvalidPacket) {
+				logrus.WithError(err).WithFields(logrus.Fields{"flow": f.id}).Trace("Could not receive packet")
+			}
+			continue
+		}
+		f.mu.Lock()
+		if _, ok := f.pending.Remove(seq); ok {
+			f.rtt.Add(rtt)
+			f.received++
+		}
+		f.mu.Unlock()
+	}
+}
+
+// isClosed returns true when the flow is done
+func (f *flow) isClosed() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// expired returns true when the flow has been done for longer than FLOW_STATUS_TTL
+func (f *flow) expired(now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.stopped.IsZero() && now.Sub(f.stopped) > FLOW_STATUS_TTL
+}
+
+// checkLoss counts packets not answered before the timeout as lost
+func (f *flow) checkLoss() {
+	deadline := f.conn.Elapsed() - time.Duration(f.conf.Timeout)
+	f.mu.Lock()
+	f.pending.Expire(deadline)
+	f.mu.Unlock()
+}
+
+// status returns the status of the flow
+func (f *flow) status() FlowStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return FlowStatus{
+		Id:         f.id,
+		UeIpAddr:   f.ueIp,
+		Config:     f.conf,
+		Running:    !f.isClosed(),
+		Start:      f.conn.Start(),
+		Sent:       f.sent,
+		Received:   f.received,
+		Lost:       f.pending.Lost(),
+		SendErrors: f.sendErrors,
+		Latency:    f.rtt.Status(),
+	}
+}
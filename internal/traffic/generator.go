@@ -0,0 +1,189 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package traffic
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/common"
+	"github.com/nextmn/ue-lite/internal/echo"
+	"github.com/nextmn/ue-lite/internal/session"
+	"github.com/nextmn/ue-lite/internal/tun"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// The status of a flow is kept this long after it is done
+const FLOW_STATUS_TTL = 10 * time.Minute
+
+// Generator sends flows of packets over PDU Sessions
+type Generator struct {
+	common.WithContext
+
+	ps     *session.PduSessions
+	tunMan *tun.TunManager
+
+	mu     sync.Mutex
+	flows  map[uint32]*flow
+	nextId uint32
+}
+
+type FlowIdMsg struct {
+	Id uint32 `json:"id"`
+}
+
+func NewGenerator(ps *session.PduSessions, tunMan *tun.TunManager) *Generator {
+	return &Generator{
+		ps:     ps,
+		tunMan: tunMan,
+		flows:  make(map[uint32]*flow),
+		nextId: 1,
+	}
+}
+
+func (g *Generator) Register(e *gin.Engine) {
+	e.GET("/traffic", g.Status)
+	e.POST("/traffic/start", g.StartFlow)
+	e.POST("/traffic/stop", g.StopFlow)
+}
+
+func (g *Generator) Start(ctx context.Context) error {
+	g.InitContext(ctx)
+	return nil
+}
+
+// WaitShutdown waits for flows to be stopped
+func (g *Generator) WaitShutdown(ctx context.Context) error {
+	g.mu.Lock()
+	flows := make([]*flow, 0, len(g.flows))
+	for _, f := range g.flows {
+		flows = append(flows, f)
+	}
+	g.mu.Unlock()
+	for _, f := range flows {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-f.done:
+		}
+	}
+	return nil
+}
+
+// evict removes flows done for longer than FLOW_STATUS_TTL; mu must be held
+func (g *Generator) evict() {
+	now := time.Now()
+	maps.DeleteFunc(g.flows, func(_ uint32, f *flow) bool {
+		return f.expired(now)
+	})
+}
+
+// Status returns the status of all flows
+func (g *Generator) Status(c *gin.Context) {
+	g.mu.Lock()
+	g.evict()
+	flows := make([]FlowStatus, 0, len(g.flows))
+	for _, f := range g.flows {
+		flows = append(flows, f.status())
+	}
+	g.mu.Unlock()
+	slices.SortFunc(flows, func(a, b FlowStatus) int { return cmp.Compare(a.Id, b.Id) })
+
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, flows)
+}
+
+// StartFlow starts a flow over a PDU Session
+func (g *Generator) StartFlow(c *gin.Context) {
+	var conf FlowConfig
+	if err := c.BindJSON(&conf); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	conf = conf.withDefaults()
+	ueIp, _, err := g.ps.Lookup(conf.Dnn, conf.Addr)
+	if err != nil {
+		c.JSON(http.StatusNotFound, jsonapi.MessageWithError{Message: "could not start flow", Error: err})
+		return
+	}
+	target, err := conf.target()
+	if err == nil {
+		ueIp = g.ps.SourceAddr(ueIp, target.Addr())
+		err = conf.validate(ueIp, target)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not start flow", Error: err})
+		return
+	}
+	conn, err := g.tunMan.DialContext(g.Context(), string(conf.Protocol), ueIp, target)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"ue-ip-addr": ueIp,
+			"target":     target,
+		}).Error("Could not start flow")
+		c.JSON(http.StatusInternalServerError, jsonapi.MessageWithError{Message: "could not start flow", Error: err})
+		return
+	}
+
+	g.mu.Lock()
+	id := g.nextId
+	g.nextId++
+	g.mu.Unlock()
+	ec, err := echo.NewConn(conn, conf.Protocol == ProtocolIcmp, ueIp, id, conf.Size)
+	if err != nil {
+		conn.Close()
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not start flow", Error: err})
+		return
+	}
+
+	g.mu.Lock()
+	g.evict()
+	f := newFlow(id, ueIp, conf, ec)
+	ctx, cancel := context.WithCancel(g.Context())
+	f.cancel = cancel
+	g.flows[f.id] = f
+	g.mu.Unlock()
+	go f.run(ctx)
+	logrus.WithFields(logrus.Fields{
+		"flow":       f.id,
+		"ue-ip-addr": ueIp,
+		"target":     target,
+		"protocol":   conf.Protocol,
+		"pattern":    conf.Pattern,
+		"rate":       conf.Rate,
+	}).Info("Flow started")
+	c.JSON(http.StatusCreated, f.status())
+}
+
+// StopFlow stops a flow; its status is kept for FLOW_STATUS_TTL
+func (g *Generator) StopFlow(c *gin.Context) {
+	var msg FlowIdMsg
+	if err := c.BindJSON(&msg); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	g.mu.Lock()
+	f, ok := g.flows[msg.Id]
+	g.mu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, jsonapi.MessageWithError{Message: "could not stop flow", Error: ErrFlowNotFound})
+		return
+	}
+	f.cancel()
+	logrus.WithFields(logrus.Fields{"flow": f.id}).Info("Flow stopped")
+	c.JSON(http.StatusOK, f.status())
+}
@@ -0,0 +1,151 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package tun
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+var (
+	ErrNoTapIface       = errors.New("no TAP interface: Ethernet PDU Sessions are not enabled")
+	ErrNotSupported     = errors.New("network configuration is not supported on this platform")
+	ErrInvalidMtu       = errors.New("invalid MTU")
+	ErrNoSessionRouting = errors.New("no routing table for this PDU Session")
+	ErrLinkInUse        = errors.New("the interface is in use, e.g. by another instance: set another name or instance identifier")
+	ErrNetnsInUse       = errors.New("the network namespace is already used by another PDU Session or by the TUN interface")
+
+	ErrUnknownFirewallBackend = errors.New("unknown firewall backend")
+	ErrNoFirewallBackend      = errors.New("no firewall backend available: install nftables support or iptables")
+
+	ErrUserspaceEthernet = errors.New("Ethernet PDU Sessions are not supported by the userspace network stack")
+	ErrUserspaceNetns    = errors.New("network namespaces are not supported by the userspace network stack")
+
+	ErrUserspaceExec = errors.New("commands cannot use PDU Sessions of the userspace network stack: use local proxies instead")
+)
+
+// LinkError is returned when the configuration of a network interface fails
+type LinkError struct {
+	Op   string
+	Link string
+	Err  error
+}
+
+func (e *LinkError) Error() string {
+	return fmt.Sprintf("could not %s of link %s: %s", e.Op, e.Link, e.Err)
+}
+
+func (e *LinkError) Unwrap() error {
+	return e.Err
+}
+
+// AddrError is returned when an address cannot be added to or removed from a network interface
+type AddrError struct {
+	Op   string
+	Link string
+	Addr netip.Prefix
+	Err  error
+}
+
+func (e *AddrError) Error() string {
+	return fmt.Sprintf("could not %s address %s on link %s: %s", e.Op, e.Addr, e.Link, e.Err)
+}
+
+func (e *AddrError) Unwrap() error {
+	return e.Err
+}
+
+// RouteError is returned when a route cannot be installed or removed
+type RouteError struct {
+	Op   string
+	Link string
+	Dst  netip.Prefix
+	Err  error
+}
+
+func (e *RouteError) Error() string {
+	return fmt.Sprintf("could not %s route to %s via link %s: %s", e.Op, e.Dst, e.Link, e.Err)
+}
+
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+// RuleError is returned when a policy routing rule cannot be installed or removed
+type RuleError struct {
+	Op    string
+	Src   netip.Prefix
+	Table int
+	Err   error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("could not %s rule from %s lookup %d: %s", e.Op, e.Src, e.Table, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// NetnsError is returned when a network namespace cannot be configured
+type NetnsError struct {
+	Op    string
+	Netns string
+	Err   error
+}
+
+func (e *NetnsError) Error() string {
+	return fmt.Sprintf("could not %s network namespace %s: %s", e.Op, e.Netns, e.Err)
+}
+
+func (e *NetnsError) Unwrap() error {
+	return e.Err
+}
+
+// SysctlError is returned when a kernel parameter cannot be set
+type SysctlError struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (e *SysctlError) Error() string {
+	return fmt.Sprintf("could not set %s to %s: %s", e.Key, e.Value, e.Err)
+}
+
+func (e *SysctlError) Unwrap() error {
+	return e.Err
+}
+
+// ReconcileError is returned when the state left by a previous run cannot be removed
+type ReconcileError struct {
+	Op  string
+	Err error
+}
+
+func (e *ReconcileError) Error() string {
+	return fmt.Sprintf("could not %s left by a previous run: %s", e.Op, e.Err)
+}
+
+func (e *ReconcileError) Unwrap() error {
+	return e.Err
+}
+
+// FirewallError is returned when a firewall rule cannot be installed or removed
+type FirewallError struct {
+	Op    string
+	Table string
+	Err   error
+}
+
+func (e *FirewallError) Error() string {
+	return fmt.Sprintf("could not %s firewall table %s: %s", e.Op, e.Table, e.Err)
+}
+
+func (e *FirewallError) Unwrap() error {
+	return e.Err
+}
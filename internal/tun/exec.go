@@ -0,0 +1,31 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package tun
+
+import (
+	"net/netip"
+	"os/exec"
+)
+
+// StartCommand starts cmd in the network namespace of this PDU Session.
+// Without it, cmd is started in the namespace of the TUN interface: the routing table of the PDU Session
+// is only used by packets whose source is the UE IP Address, so cmd must bind to it (e.g. `ping -I <ue-ip-addr>`).
+// PDU Sessions without a routing table (e.g. Ethernet PDU Sessions) are refused.
+func (t *TunManager) StartCommand(cmd *exec.Cmd, ip netip.Addr) error {
+	if t.stack != nil {
+		return ErrUserspaceExec
+	}
+	if netns, ok := t.SessionNetns(ip); ok {
+		return inNetns(netns, cmd.Start)
+	}
+	t.routingMu.Lock()
+	_, ok := t.routingTables[ip.Unmap()]
+	t.routingMu.Unlock()
+	if !ok {
+		return ErrNoSessionRouting
+	}
+	return t.do(cmd.Start)
+}
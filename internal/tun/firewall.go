@@ -0,0 +1,98 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package tun
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/nextmn/ue-lite/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Name of the table (or chain, for iptables backends) holding the firewall rules of the UE;
+// instances other than 0 use "<FIREWALL_TABLE_NAME>-<instance>"
+const FIREWALL_TABLE_NAME = "nextmn-ue-lite"
+
+// ICMP type of redirect messages (RFC 792)
+const icmpTypeRedirect = 5
+
+// ICMPv6 type of redirect messages (RFC 4861)
+const icmpv6TypeRedirect = 137
+
+// Firewall manages the rules of the UE in a dedicated table,
+// so they can be removed without touching rules of other programs.
+type Firewall interface {
+	// Backend returns the backend used to manage the rules
+	Backend() config.FirewallBackend
+	// Init creates the dedicated table, removing rules left by a previous run
+	Init(ctx context.Context) error
+	// DropIcmpRedirects drops ICMP and ICMPv6 redirects sent through the interface
+	DropIcmpRedirects(ctx context.Context, iface string) error
+	// Cleanup removes the dedicated table and all its rules
+	Cleanup(ctx context.Context) error
+}
+
+// NewFirewall returns a Firewall using this backend, managing rules in the given table.
+// The auto backend (or an empty backend) selects the first one available on the host
+// among nftables, iptables-nft and iptables-legacy.
+func NewFirewall(backend config.FirewallBackend, table string) (Firewall, error) {
+	switch backend {
+	case "", config.FirewallBackendAuto:
+		return detectFirewall(table)
+	case config.FirewallBackendNftables:
+		return newNftablesFirewall(table)
+	case config.FirewallBackendIptablesNft, config.FirewallBackendIptablesLegacy:
+		return newIptablesFirewall(backend, table)
+	default:
+		return nil, ErrUnknownFirewallBackend
+	}
+}
+
+func detectFirewall(table string) (Firewall, error) {
+	for _, backend := range []config.FirewallBackend{
+		config.FirewallBackendNftables,
+		config.FirewallBackendIptablesNft,
+		config.FirewallBackendIptablesLegacy,
+	} {
+		fw, err := NewFirewall(backend, table)
+		if err == nil {
+			return fw, nil
+		}
+		logrus.WithError(err).WithFields(logrus.Fields{"backend": backend}).Debug("Firewall backend is not available")
+	}
+	return nil, ErrNoFirewallBackend
+}
+
+// lookIptables returns the path of the iptables (or ip6tables) binary implementing this backend
+func lookIptables(backend config.FirewallBackend, ipv6 bool) (string, error) {
+	name := "iptables"
+	if ipv6 {
+		name = "ip6tables"
+	}
+	// e.g. `ip6tables-nft` for the iptables-nft backend
+	if path, err := exec.LookPath(strings.Replace(string(backend), "iptables", name, 1)); err == nil {
+		return path, nil
+	}
+	// distributions without alternatives only ship `iptables`: check its variant
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	// iptables < 1.8 does not print its variant, and is always legacy
+	nft := bytes.Contains(out, []byte("(nf_tables)"))
+	if nft != (backend == config.FirewallBackendIptablesNft) {
+		return "", ErrNoFirewallBackend
+	}
+	return path, nil
+}
@@ -0,0 +1,124 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package tun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/nextmn/ue-lite/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Maximum number of duplicated rules left in the OUTPUT chain by previous versions that are removed
+const IPTABLES_LEGACY_RULES_MAX = 100
+
+// iptablesFirewall manages rules using the iptables and ip6tables binaries (legacy or nf_tables variant).
+// Since iptables cannot create tables, rules are kept in a dedicated chain
+// of the filter table, called from the OUTPUT chain.
+type iptablesFirewall struct {
+	backend config.FirewallBackend
+	path    string
+	path6   string // ip6tables; IPv6 rules are not installed if it is not available
+	chain   string
+}
+
+func newIptablesFirewall(backend config.FirewallBackend, chain string) (Firewall, error) {
+	path, err := lookIptables(backend, false)
+	if err != nil {
+		return nil, err
+	}
+	path6, err := lookIptables(backend, true)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"backend": backend}).Warn("ip6tables is not available: ICMPv6 redirects will not be dropped")
+	}
+	return &iptablesFirewall{
+		backend: backend,
+		path:    path,
+		path6:   path6,
+		chain:   chain,
+	}, nil
+}
+
+// paths returns the paths of iptables, and of ip6tables if available
+func (fw *iptablesFirewall) paths() []string {
+	if fw.path6 == "" {
+		return []string{fw.path}
+	}
+	return []string{fw.path, fw.path6}
+}
+
+func (fw *iptablesFirewall) Backend() config.FirewallBackend {
+	return fw.backend
+}
+
+// run runs the iptables (or ip6tables) command, waiting for the xtables lock if needed
+func (fw *iptablesFirewall) run(ctx context.Context, path string, args ...string) error {
+	cmd := exec.CommandContext(ctx, path, append([]string{"-w"}, args...)...)
+	cmd.Env = []string{}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error running %s: %w: %s", cmd.Args, err, out)
+	}
+	return nil
+}
+
+func (fw *iptablesFirewall) Init(ctx context.Context) error {
+	for _, path := range fw.paths() {
+		// the chain may be left by a previous run
+		if err := fw.run(ctx, path, "-F", fw.chain); err != nil {
+			if err := fw.run(ctx, path, "-N", fw.chain); err != nil {
+				return &FirewallError{Op: "create", Table: fw.chain, Err: err}
+			}
+		}
+		if err := fw.run(ctx, path, "-C", "OUTPUT", "-j", fw.chain); err == nil {
+			continue
+		}
+		if err := fw.run(ctx, path, "-I", "OUTPUT", "-j", fw.chain); err != nil {
+			return &FirewallError{Op: "hook", Table: fw.chain, Err: err}
+		}
+	}
+	return nil
+}
+
+func (fw *iptablesFirewall) DropIcmpRedirects(ctx context.Context, iface string) error {
+	// previous versions appended this rule directly to the OUTPUT chain, and did not always remove it
+	for range IPTABLES_LEGACY_RULES_MAX {
+		if err := fw.run(ctx, fw.path, "-D", "OUTPUT", "-o", iface, "-p", "icmp", "--icmp-type", "redirect", "-j", "DROP"); err != nil {
+			break
+		}
+	}
+	if err := fw.run(ctx, fw.path, "-A", fw.chain, "-o", iface, "-p", "icmp", "--icmp-type", "redirect", "-j", "DROP"); err != nil {
+		return &FirewallError{Op: "add rule to", Table: fw.chain, Err: err}
+	}
+	if fw.path6 == "" {
+		return nil
+	}
+	if err := fw.run(ctx, fw.path6, "-A", fw.chain, "-o", iface, "-p", "icmpv6", "--icmpv6-type", "redirect", "-j", "DROP"); err != nil {
+		return &FirewallError{Op: "add rule to", Table: fw.chain, Err: err}
+	}
+	return nil
+}
+
+func (fw *iptablesFirewall) Cleanup(ctx context.Context) error {
+	var errs []error
+	for _, path := range fw.paths() {
+		if err := fw.run(ctx, path, "-D", "OUTPUT", "-j", fw.chain); err != nil {
+			errs = append(errs, &FirewallError{Op: "unhook", Table: fw.chain, Err: err})
+			continue
+		}
+		if err := fw.run(ctx, path, "-F", fw.chain); err != nil {
+			errs = append(errs, &FirewallError{Op: "flush", Table: fw.chain, Err: err})
+			continue
+		}
+		if err := fw.run(ctx, path, "-X", fw.chain); err != nil {
+			errs = append(errs, &FirewallError{Op: "delete", Table: fw.chain, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,124 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+
+package tun
+
+import (
+	"context"
+
+	"github.com/nextmn/ue-lite/internal/config"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+// nftablesFirewall manages rules in a dedicated nftables table of the inet family (IPv4 and IPv6), using netlink
+type nftablesFirewall struct {
+	table *nftables.Table
+	chain *nftables.Chain
+}
+
+func newNftablesFirewall(name string) (Firewall, error) {
+	conn, err := nftables.New()
+	if err != nil {
+		return nil, err
+	}
+	// check nf_tables is available and we are allowed to use it
+	if _, err := conn.ListTablesOfFamily(nftables.TableFamilyINet); err != nil {
+		return nil, err
+	}
+	table := &nftables.Table{
+		Name:   name,
+		Family: nftables.TableFamilyINet,
+	}
+	return &nftablesFirewall{
+		table: table,
+		chain: &nftables.Chain{
+			Name:     "output",
+			Table:    table,
+			Type:     nftables.ChainTypeFilter,
+			Hooknum:  nftables.ChainHookOutput,
+			Priority: nftables.ChainPriorityFilter,
+		},
+	}, nil
+}
+
+func (fw *nftablesFirewall) Backend() config.FirewallBackend {
+	return config.FirewallBackendNftables
+}
+
+func (fw *nftablesFirewall) Init(ctx context.Context) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return &FirewallError{Op: "connect to", Table: fw.table.Name, Err: err}
+	}
+	// previous versions used a table of the ip family, with the same name
+	if tables, err := conn.ListTablesOfFamily(nftables.TableFamilyIPv4); err == nil {
+		for _, table := range tables {
+			if table.Name == fw.table.Name {
+				conn.DelTable(table)
+			}
+		}
+	}
+	conn.AddTable(fw.table)
+	conn.FlushTable(fw.table) // rules of a previous run
+	conn.AddChain(fw.chain)
+	if err := conn.Flush(); err != nil {
+		return &FirewallError{Op: "create", Table: fw.table.Name, Err: err}
+	}
+	return nil
+}
+
+func (fw *nftablesFirewall) DropIcmpRedirects(ctx context.Context, iface string) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return &FirewallError{Op: "connect to", Table: fw.table.Name, Err: err}
+	}
+	ifname := make([]byte, unix.IFNAMSIZ)
+	copy(ifname, iface)
+	for _, redirect := range []struct {
+		l4proto  byte
+		icmpType byte
+	}{
+		{l4proto: unix.IPPROTO_ICMP, icmpType: icmpTypeRedirect},
+		{l4proto: unix.IPPROTO_ICMPV6, icmpType: icmpv6TypeRedirect},
+	} {
+		conn.AddRule(&nftables.Rule{
+			Table: fw.table,
+			Chain: fw.chain,
+			Exprs: []expr.Any{
+				// oifname == iface
+				&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ifname},
+				// meta l4proto == icmp (or icmpv6)
+				&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{redirect.l4proto}},
+				// icmp type == redirect (or icmpv6 type == nd-redirect)
+				&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 0, Len: 1},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{redirect.icmpType}},
+				&expr.Verdict{Kind: expr.VerdictDrop},
+			},
+		})
+	}
+	if err := conn.Flush(); err != nil {
+		return &FirewallError{Op: "add rule to", Table: fw.table.Name, Err: err}
+	}
+	return nil
+}
+
+func (fw *nftablesFirewall) Cleanup(ctx context.Context) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return &FirewallError{Op: "connect to", Table: fw.table.Name, Err: err}
+	}
+	conn.DelTable(fw.table)
+	if err := conn.Flush(); err != nil {
+		return &FirewallError{Op: "delete", Table: fw.table.Name, Err: err}
+	}
+	return nil
+}
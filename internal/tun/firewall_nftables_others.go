@@ -0,0 +1,13 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+
+package tun
+
+// nftables backend is only available on Linux
+func newNftablesFirewall(name string) (Firewall, error) {
+	return nil, ErrNotSupported
+}
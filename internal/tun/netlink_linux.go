@@ -0,0 +1,201 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+
+package tun
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// ipNet converts a prefix to the representation used by netlink
+func ipNet(p netip.Prefix) *net.IPNet {
+	return &net.IPNet{
+		IP:   p.Addr().AsSlice(),
+		Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen()),
+	}
+}
+
+// setupLink sets the MTU of the interface, and sets it up
+func setupLink(name string, mtu int) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return &LinkError{Op: "find", Link: name, Err: err}
+	}
+	if err := netlink.LinkSetMTU(link, mtu); err != nil {
+		return &LinkError{Op: "set mtu", Link: name, Err: err}
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		return &LinkError{Op: "set up", Link: name, Err: err}
+	}
+	return nil
+}
+
+// setLinkUp sets the interface up
+func setLinkUp(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return &LinkError{Op: "find", Link: name, Err: err}
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		return &LinkError{Op: "set up", Link: name, Err: err}
+	}
+	return nil
+}
+
+// replaceRoute routes dst through the interface in this routing table (0 for the main table),
+// replacing any existing route to dst. If src is valid, it is used as preferred source address.
+func replaceRoute(name string, dst netip.Prefix, src netip.Addr, table int) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return &LinkError{Op: "find", Link: name, Err: err}
+	}
+	route := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       ipNet(dst),
+		Table:     table,
+		Protocol:  ROUTE_PROTOCOL,
+	}
+	if dst.Addr().Is4() {
+		route.Scope = netlink.SCOPE_LINK
+	}
+	if src.IsValid() {
+		route.Src = src.AsSlice()
+	}
+	if err := netlink.RouteReplace(route); err != nil {
+		return &RouteError{Op: "replace", Link: name, Dst: dst, Err: err}
+	}
+	return nil
+}
+
+// replaceSessionRoute installs the route to dst through the interface in the main table, using src as source,
+// with this metric: routes with another metric are kept
+func replaceSessionRoute(name string, dst netip.Prefix, src netip.Addr, metric int) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return &LinkError{Op: "find", Link: name, Err: err}
+	}
+	if err := netlink.RouteReplace(sessionRoute(link, dst, src, metric)); err != nil {
+		return &RouteError{Op: "replace", Link: name, Dst: dst, Err: err}
+	}
+	return nil
+}
+
+// delSessionRoute removes the route installed by replaceSessionRoute
+func delSessionRoute(name string, dst netip.Prefix, src netip.Addr, metric int) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return &LinkError{Op: "find", Link: name, Err: err}
+	}
+	if err := netlink.RouteDel(sessionRoute(link, dst, src, metric)); err != nil {
+		return &RouteError{Op: "delete", Link: name, Dst: dst, Err: err}
+	}
+	return nil
+}
+
+func sessionRoute(link netlink.Link, dst netip.Prefix, src netip.Addr, metric int) *netlink.Route {
+	route := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       ipNet(dst),
+		Src:       src.AsSlice(),
+		Priority:  metric,
+		Protocol:  ROUTE_PROTOCOL,
+	}
+	if dst.Addr().Is4() {
+		route.Scope = netlink.SCOPE_LINK
+	}
+	return route
+}
+
+// delRoute removes the route to dst through the interface from this routing table (0 for the main table)
+func delRoute(name string, dst netip.Prefix, table int) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return &LinkError{Op: "find", Link: name, Err: err}
+	}
+	if err := netlink.RouteDel(&netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       ipNet(dst),
+		Table:     table,
+	}); err != nil {
+		return &RouteError{Op: "delete", Link: name, Dst: dst, Err: err}
+	}
+	return nil
+}
+
+func newRule(src netip.Prefix, table int, priority int) *netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Src = ipNet(src)
+	rule.Table = table
+	rule.Priority = priority
+	rule.Protocol = ROUTE_PROTOCOL
+	rule.Family = unix.AF_INET
+	if src.Addr().Is6() {
+		rule.Family = unix.AF_INET6
+	}
+	return rule
+}
+
+// addRule makes packets from src use this routing table
+func addRule(src netip.Prefix, table int, priority int) error {
+	if err := netlink.RuleAdd(newRule(src, table, priority)); err != nil {
+		return &RuleError{Op: "add", Src: src, Table: table, Err: err}
+	}
+	return nil
+}
+
+// delRule removes a rule created by addRule
+func delRule(src netip.Prefix, table int, priority int) error {
+	if err := netlink.RuleDel(newRule(src, table, priority)); err != nil {
+		return &RuleError{Op: "delete", Src: src, Table: table, Err: err}
+	}
+	return nil
+}
+
+// addAddr configures the address on the interface
+func addAddr(name string, addr netip.Prefix) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return &LinkError{Op: "find", Link: name, Err: err}
+	}
+	a := &netlink.Addr{IPNet: ipNet(addr)}
+	if addr.Addr().Is6() {
+		// no Duplicate Address Detection on a point-to-point radio link
+		a.Flags = unix.IFA_F_NODAD
+	}
+	if err := netlink.AddrAdd(link, a); err != nil {
+		return &AddrError{Op: "add", Link: name, Addr: addr, Err: err}
+	}
+	return nil
+}
+
+// delAddr removes the address from the interface
+func delAddr(name string, addr netip.Prefix) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return &LinkError{Op: "find", Link: name, Err: err}
+	}
+	if err := netlink.AddrDel(link, &netlink.Addr{IPNet: ipNet(addr)}); err != nil {
+		return &AddrError{Op: "delete", Link: name, Addr: addr, Err: err}
+	}
+	return nil
+}
+
+// CheckNetlink checks links and policy routing rules can be listed using netlink
+func CheckNetlink() error {
+	if _, err := netlink.LinkList(); err != nil {
+		return fmt.Errorf("could not list links: %w", err)
+	}
+	if _, err := netlink.RuleList(unix.AF_UNSPEC); err != nil {
+		return fmt.Errorf("could not list rules: %w", err)
+	}
+	return nil
+}
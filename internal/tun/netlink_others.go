@@ -0,0 +1,59 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+
+package tun
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+func setupLink(name string, mtu int) error {
+	return &LinkError{Op: "configure", Link: name, Err: ErrNotSupported}
+}
+
+func setLinkUp(name string) error {
+	return &LinkError{Op: "set up", Link: name, Err: ErrNotSupported}
+}
+
+func replaceRoute(name string, dst netip.Prefix, src netip.Addr, table int) error {
+	return &RouteError{Op: "replace", Link: name, Dst: dst, Err: ErrNotSupported}
+}
+
+// routes, rules and addresses cannot be created on this platform, so there is nothing to delete
+func delRoute(name string, dst netip.Prefix, table int) error {
+	return nil
+}
+
+func replaceSessionRoute(name string, dst netip.Prefix, src netip.Addr, metric int) error {
+	return &RouteError{Op: "replace", Link: name, Dst: dst, Err: ErrNotSupported}
+}
+
+func delSessionRoute(name string, dst netip.Prefix, src netip.Addr, metric int) error {
+	return nil
+}
+
+func addRule(src netip.Prefix, table int, priority int) error {
+	return &RuleError{Op: "add", Src: src, Table: table, Err: ErrNotSupported}
+}
+
+func delRule(src netip.Prefix, table int, priority int) error {
+	return nil
+}
+
+func addAddr(name string, addr netip.Prefix) error {
+	return &AddrError{Op: "add", Link: name, Addr: addr, Err: ErrNotSupported}
+}
+
+func delAddr(name string, addr netip.Prefix) error {
+	return nil
+}
+
+// CheckNetlink checks links and policy routing rules can be listed using netlink
+func CheckNetlink() error {
+	return fmt.Errorf("could not list links: %w", ErrNotSupported)
+}
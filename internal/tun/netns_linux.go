@@ -0,0 +1,221 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+
+package tun
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// openNetns returns the named network namespace, creating it if it does not exist
+func openNetns(name string) (ns netns.NsHandle, created bool, err error) {
+	if ns, err := netns.GetFromName(name); err == nil {
+		return ns, false, nil
+	}
+	// creating a namespace moves the current thread into it
+	runtime.LockOSThread()
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return netns.None(), false, err
+	}
+	defer origin.Close()
+	ns, err = netns.NewNamed(name)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return netns.None(), false, err
+	}
+	if err := netns.Set(origin); err != nil {
+		// the thread stays locked, so it is terminated instead of being reused in the wrong namespace
+		ns.Close()
+		return netns.None(), false, err
+	}
+	runtime.UnlockOSThread()
+	return ns, true, nil
+}
+
+// createNetns creates the named network namespace if it does not exist, and returns true if it has been created
+func createNetns(name string) (bool, error) {
+	ns, created, err := openNetns(name)
+	if err != nil {
+		return false, &NetnsError{Op: "create", Netns: name, Err: err}
+	}
+	ns.Close()
+	return created, nil
+}
+
+// deleteNetns deletes the named network namespace
+func deleteNetns(name string) error {
+	if err := netns.DeleteNamed(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return &NetnsError{Op: "delete", Netns: name, Err: err}
+	}
+	return nil
+}
+
+// inNetns runs f with the current thread in the named network namespace.
+// Sockets (including netlink sockets) and child processes created by f belong to this namespace.
+func inNetns(name string, f func() error) error {
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		return &NetnsError{Op: "open", Netns: name, Err: err}
+	}
+	defer ns.Close()
+	runtime.LockOSThread()
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return &NetnsError{Op: "open", Netns: name, Err: err}
+	}
+	defer origin.Close()
+	if err := netns.Set(ns); err != nil {
+		runtime.UnlockOSThread()
+		return &NetnsError{Op: "enter", Netns: name, Err: err}
+	}
+	ferr := f()
+	if err := netns.Set(origin); err != nil {
+		// the thread stays locked, so it is terminated instead of being reused in the wrong namespace
+		return &NetnsError{Op: "leave", Netns: name, Err: err}
+	}
+	runtime.UnlockOSThread()
+	return ferr
+}
+
+// setupSessionNetns creates the named network namespace (if it does not exist) with a veth pair:
+// hostIface stays in the current namespace and routes the UE IP Addresses,
+// and its peer, named like the TUN interface, is moved in the namespace with the UE IP Addresses
+// and a default route for the address family of each of them.
+// It returns true if the namespace has been created, including on error, so it can be removed.
+// Kernel parameters modified on the TUN interface and host-wide are saved in sysctls.
+func setupSessionNetns(name string, hostIface string, tunName string, mtu int, ips []netip.Addr, sysctls sysctlBackup) (bool, error) {
+	ns, created, err := openNetns(name)
+	if err != nil {
+		return false, &NetnsError{Op: "create", Netns: name, Err: err}
+	}
+	defer ns.Close()
+	veth := &netlink.Veth{
+		LinkAttrs:     netlink.LinkAttrs{Name: hostIface, MTU: mtu},
+		PeerName:      tunName,
+		PeerNamespace: netlink.NsFd(ns),
+	}
+	if err := netlink.LinkAdd(veth); err != nil {
+		return created, &LinkError{Op: "create", Link: hostIface, Err: err}
+	}
+
+	// host side
+	if err := setupLink(hostIface, mtu); err != nil {
+		return created, err
+	}
+	for _, ip := range ips {
+		gw := netnsGateway(ip)
+		if err := addAddr(hostIface, netip.PrefixFrom(gw, gw.BitLen())); err != nil {
+			return created, err
+		}
+		if err := replaceRoute(hostIface, netip.PrefixFrom(ip, prefixLen(ip)), netip.Addr{}, 0); err != nil {
+			return created, err
+		}
+		if err := enableForwarding(ip, tunName, hostIface, sysctls); err != nil {
+			return created, err
+		}
+	}
+
+	// namespace side
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return created, &NetnsError{Op: "open", Netns: name, Err: err}
+	}
+	defer h.Close()
+	for _, iface := range []string{"lo", tunName} {
+		link, err := h.LinkByName(iface)
+		if err != nil {
+			return created, &NetnsError{Op: "find link " + iface + " in", Netns: name, Err: err}
+		}
+		if err := h.LinkSetUp(link); err != nil {
+			return created, &NetnsError{Op: "set up link " + iface + " in", Netns: name, Err: err}
+		}
+		if iface == "lo" {
+			continue
+		}
+		for _, ip := range ips {
+			addr := &netlink.Addr{IPNet: ipNet(netip.PrefixFrom(ip, prefixLen(ip)))}
+			if ip.Is6() {
+				addr.Flags = unix.IFA_F_NODAD
+			}
+			if err := h.AddrAdd(link, addr); err != nil {
+				return created, &NetnsError{Op: "add address " + ip.String() + " in", Netns: name, Err: err}
+			}
+			if err := h.RouteReplace(&netlink.Route{
+				LinkIndex: link.Attrs().Index,
+				Dst:       ipNet(defaultPrefix(ip)),
+				Gw:        netnsGateway(ip).AsSlice(),
+				Flags:     int(netlink.FLAG_ONLINK),
+			}); err != nil {
+				return created, &NetnsError{Op: "add default route in", Netns: name, Err: err}
+			}
+		}
+	}
+	return created, nil
+}
+
+// teardownSessionNetns removes the veth pair, and the named network namespace if it has been created by the UE
+func teardownSessionNetns(name string, hostIface string, created bool) error {
+	if link, err := netlink.LinkByName(hostIface); err == nil {
+		if err := netlink.LinkDel(link); err != nil {
+			return &LinkError{Op: "delete", Link: hostIface, Err: err}
+		}
+	}
+	if !created {
+		return nil
+	}
+	return deleteNetns(name)
+}
+
+// enableForwarding enables forwarding between the TUN interface and the veth pair for the address family of ip,
+// and loose reverse path filtering on the TUN interface since downlink packets come from the Data Network.
+// Forwarding is enabled per interface, except for IPv6 on kernels without `force_forwarding` (before Linux 6.17),
+// where it is enabled host-wide. Parameters of the veth pair are removed with it; others are saved in sysctls.
+func enableForwarding(ip netip.Addr, tunName string, hostIface string, sysctls sysctlBackup) error {
+	if ip.Is6() {
+		if _, err := readSysctl(fmt.Sprintf("net/ipv6/conf/%s/force_forwarding", tunName)); err != nil {
+			return sysctls.set("net/ipv6/conf/all/forwarding", "1")
+		}
+		if err := sysctls.set(fmt.Sprintf("net/ipv6/conf/%s/force_forwarding", tunName), "1"); err != nil {
+			return err
+		}
+		return writeSysctl(fmt.Sprintf("net/ipv6/conf/%s/force_forwarding", hostIface), "1")
+	}
+	if err := sysctls.set(fmt.Sprintf("net/ipv4/conf/%s/forwarding", tunName), "1"); err != nil {
+		return err
+	}
+	if err := sysctls.set(fmt.Sprintf("net/ipv4/conf/%s/rp_filter", tunName), "2"); err != nil {
+		return err
+	}
+	return writeSysctl(fmt.Sprintf("net/ipv4/conf/%s/forwarding", hostIface), "1")
+}
+
+func readSysctl(key string) (string, error) {
+	v, err := os.ReadFile("/proc/sys/" + key)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(v)), nil
+}
+
+func writeSysctl(key string, value string) error {
+	if err := os.WriteFile("/proc/sys/"+key, []byte(value), 0o644); err != nil {
+		return &SysctlError{Key: key, Value: value, Err: err}
+	}
+	return nil
+}
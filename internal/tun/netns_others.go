@@ -0,0 +1,39 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+
+package tun
+
+import "net/netip"
+
+func setupSessionNetns(name string, hostIface string, tunName string, mtu int, ips []netip.Addr, sysctls sysctlBackup) (bool, error) {
+	return false, &NetnsError{Op: "create", Netns: name, Err: ErrNotSupported}
+}
+
+// network namespaces cannot be created on this platform, so there is nothing to remove
+func teardownSessionNetns(name string, hostIface string, created bool) error {
+	return nil
+}
+
+func readSysctl(key string) (string, error) {
+	return "", ErrNotSupported
+}
+
+func writeSysctl(key string, value string) error {
+	return &SysctlError{Key: key, Value: value, Err: ErrNotSupported}
+}
+
+func createNetns(name string) (bool, error) {
+	return false, &NetnsError{Op: "create", Netns: name, Err: ErrNotSupported}
+}
+
+func deleteNetns(name string) error {
+	return &NetnsError{Op: "delete", Netns: name, Err: ErrNotSupported}
+}
+
+func inNetns(name string, f func() error) error {
+	return &NetnsError{Op: "enter", Netns: name, Err: ErrNotSupported}
+}
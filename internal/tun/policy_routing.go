@@ -0,0 +1,137 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package tun
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// First routing table used by PDU Sessions; each PDU Session has its own table.
+	// Each instance uses its own range of ROUTING_TABLES_PER_INSTANCE tables.
+	ROUTING_TABLE_BASE          = 1000
+	ROUTING_TABLES_PER_INSTANCE = 1000
+	// Priority of the `from <ue-ip>` rules, checked before the main table (32766)
+	ROUTING_RULE_PRIORITY = 1000
+)
+
+// defaultPrefix returns the default route of the address family of ip
+func defaultPrefix(ip netip.Addr) netip.Prefix {
+	if ip.Is6() {
+		return netip.PrefixFrom(netip.IPv6Unspecified(), 0)
+	}
+	return netip.PrefixFrom(netip.IPv4Unspecified(), 0)
+}
+
+// routingTableMin returns the first routing table of this instance
+func (t *TunManager) routingTableMin() int {
+	return ROUTING_TABLE_BASE + int(t.conf.Instance)*ROUTING_TABLES_PER_INSTANCE
+}
+
+// freeRoutingTable returns the first routing table not used by a PDU Session; routingMu must be held
+func (t *TunManager) freeRoutingTable() int {
+	used := make(map[int]struct{}, len(t.routingTables))
+	for _, table := range t.routingTables {
+		used[table] = struct{}{}
+	}
+	table := t.routingTableMin()
+	for {
+		if _, ok := used[table]; !ok {
+			return table
+		}
+		table++
+	}
+}
+
+// AddSessionRouting creates a routing table with a default route through the TUN interface
+// for this PDU Session, used by packets whose source is the UE IP Address.
+func (t *TunManager) AddSessionRouting(ctx context.Context, ip netip.Addr) error {
+	if t.stack != nil {
+		// the userspace network stack uses the UE IP Address chosen by the application
+		return nil
+	}
+	return t.do(func() error {
+		ip = ip.Unmap()
+		t.routingMu.Lock()
+		defer t.routingMu.Unlock()
+		if _, ok := t.routingTables[ip]; ok {
+			return nil
+		}
+		table := t.freeRoutingTable()
+		if err := replaceRoute(t.name, defaultPrefix(ip), netip.Addr{}, table); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue-ip-addr": ip,
+				"table":      table,
+			}).Error("Could not create routing table for PDU Session")
+			return err
+		}
+		src := netip.PrefixFrom(ip, prefixLen(ip))
+		if err := addRule(src, table, ROUTING_RULE_PRIORITY); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue-ip-addr": ip,
+				"table":      table,
+			}).Error("Could not add routing rule for PDU Session")
+			if err := delRoute(t.name, defaultPrefix(ip), table); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"table": table}).Warn("Could not remove route")
+			}
+			return err
+		}
+		t.routingTables[ip] = table
+		return nil
+	})
+}
+
+// DelSessionRouting removes the routing table and rule of this PDU Session, if any
+func (t *TunManager) DelSessionRouting(ctx context.Context, ip netip.Addr) error {
+	return t.do(func() error {
+		ip = ip.Unmap()
+		t.routingMu.Lock()
+		defer t.routingMu.Unlock()
+		return t.delSessionRouting(ip)
+	})
+}
+
+// delSessionRouting removes the routing table and rule of this PDU Session; routingMu must be held
+func (t *TunManager) delSessionRouting(ip netip.Addr) error {
+	table, ok := t.routingTables[ip]
+	if !ok {
+		return nil
+	}
+	delete(t.routingTables, ip)
+	if err := delRule(netip.PrefixFrom(ip, prefixLen(ip)), table, ROUTING_RULE_PRIORITY); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"ue-ip-addr": ip,
+			"table":      table,
+		}).Error("Could not remove routing rule of PDU Session")
+		return err
+	}
+	// the route is also removed by the kernel when the address is removed from the interface
+	if err := delRoute(t.name, defaultPrefix(ip), table); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"ue-ip-addr": ip,
+			"table":      table,
+		}).Debug("Could not remove routing table of PDU Session")
+	}
+	return nil
+}
+
+// cleanupSessionRouting removes the routes, routing rules and network namespaces of all PDU Sessions
+func (t *TunManager) cleanupSessionRouting() {
+	t.routingMu.Lock()
+	defer t.routingMu.Unlock()
+	for ip := range t.sessionRoutes {
+		t.delSessionRoutes(ip)
+	}
+	for ip := range t.namespaces {
+		t.delSessionNetns(ip)
+	}
+	for ip := range t.routingTables {
+		t.delSessionRouting(ip)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+
+package tun
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// leftovers identifies the state created by a previous run of this instance
+type leftovers struct {
+	ifaces     []string // TUN/TAP interfaces
+	vethPrefix string   // host side of the veth pairs of PDU Sessions network namespaces
+	tableMin   int      // routing tables of PDU Sessions
+	tableMax   int
+}
+
+func (l leftovers) ownTable(table int) bool {
+	return table >= l.tableMin && table <= l.tableMax
+}
+
+// cleanupLeftovers removes routing rules, routes, addresses and veth pairs left by a previous run
+// that has not been shut down properly. It fails without removing anything if an interface of this instance
+// is in use (e.g. by another instance using the same name).
+func cleanupLeftovers(l leftovers) error {
+	for _, name := range l.ifaces {
+		if err := checkLinkUnused(name); err != nil {
+			return err
+		}
+	}
+
+	rules, err := netlink.RuleList(netlink.FAMILY_ALL)
+	if err != nil {
+		return &ReconcileError{Op: "list routing rules", Err: err}
+	}
+	for _, rule := range rules {
+		if rule.Protocol != ROUTE_PROTOCOL || !l.ownTable(rule.Table) {
+			continue
+		}
+		logrus.WithFields(logrus.Fields{"rule": rule.String()}).Info("Removing leftover routing rule")
+		if err := netlink.RuleDel(&rule); err != nil {
+			return &ReconcileError{Op: "delete routing rule " + rule.String(), Err: err}
+		}
+	}
+
+	links, err := netlink.LinkList()
+	if err != nil {
+		return &ReconcileError{Op: "list links", Err: err}
+	}
+	ownLinks := make(map[int]string)
+	for _, link := range links {
+		name := link.Attrs().Name
+		switch {
+		case link.Type() == "veth" && strings.HasPrefix(name, l.vethPrefix):
+			// the peer is removed with it
+			logrus.WithFields(logrus.Fields{"interface": name}).Info("Removing leftover veth pair")
+			if err := netlink.LinkDel(link); err != nil {
+				return &LinkError{Op: "delete", Link: name, Err: err}
+			}
+		case slices.Contains(l.ifaces, name):
+			// persistent interface not in use
+			logrus.WithFields(logrus.Fields{"interface": name}).Warn("Interface already exists: removing its addresses")
+			ownLinks[link.Attrs().Index] = name
+			addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+			if err != nil {
+				return &LinkError{Op: "list addresses", Link: name, Err: err}
+			}
+			for _, addr := range addrs {
+				if addr.IP.IsLinkLocalUnicast() {
+					continue
+				}
+				if err := netlink.AddrDel(link, &addr); err != nil {
+					return &ReconcileError{Op: "delete address " + addr.IPNet.String() + " of link " + name, Err: err}
+				}
+			}
+		}
+	}
+
+	routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return &ReconcileError{Op: "list routes", Err: err}
+	}
+	for _, route := range routes {
+		_, ownLink := ownLinks[route.LinkIndex]
+		if !l.ownTable(route.Table) && !(ownLink && route.Protocol == ROUTE_PROTOCOL) {
+			continue
+		}
+		logrus.WithFields(logrus.Fields{"route": route.String()}).Info("Removing leftover route")
+		if err := netlink.RouteDel(&route); err != nil {
+			return &ReconcileError{Op: "delete route " + route.String(), Err: err}
+		}
+	}
+	return nil
+}
+
+// checkLinkUnused returns an error if the named interface exists and is up, attached to a process, or not a TUN/TAP interface
+func checkLinkUnused(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return &LinkError{Op: "find", Link: name, Err: err}
+	}
+	tuntap, ok := link.(*netlink.Tuntap)
+	if !ok || link.Attrs().Flags&net.FlagUp != 0 || tuntap.Queues+tuntap.DisabledQueues > 0 {
+		return &LinkError{Op: "check", Link: name, Err: ErrLinkInUse}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+
+package tun
+
+// leftovers identifies the state created by a previous run of this instance
+type leftovers struct {
+	ifaces     []string
+	vethPrefix string
+	tableMin   int
+	tableMax   int
+}
+
+// cleanupLeftovers does nothing: routes, rules and veth pairs are only created on Linux, so none can be left
+func cleanupLeftovers(l leftovers) error {
+	return nil
+}
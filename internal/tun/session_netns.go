@@ -0,0 +1,191 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package tun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Prefix of the host side of the veth pairs of PDU Sessions network namespaces,
+// which are named "<NETNS_VETH_PREFIX><instance>-ns<n>"
+const NETNS_VETH_PREFIX = "nmue"
+
+// Gateway used by network namespaces of PDU Sessions; it is configured on the host side of the veth pair
+var (
+	NETNS_GATEWAY_IPV4 = netip.MustParseAddr("169.254.0.1")
+	NETNS_GATEWAY_IPV6 = netip.MustParseAddr("fe80::1")
+)
+
+// sessionNetns is the network namespace of a PDU Session
+type sessionNetns struct {
+	name      string
+	hostIface string // host side of the veth pair
+	created   bool   // the namespace has been created by the UE, and is deleted with the PDU Session
+}
+
+// sysctlBackup contains the previous values of modified kernel parameters; key: parameter, e.g. `net/ipv4/ip_forward`
+type sysctlBackup map[string]string
+
+// set sets a kernel parameter, saving its previous value if it was not already modified
+func (b sysctlBackup) set(key string, value string) error {
+	if _, ok := b[key]; !ok {
+		prev, err := readSysctl(key)
+		if err != nil {
+			return &SysctlError{Key: key, Value: value, Err: err}
+		}
+		b[key] = prev
+	}
+	return writeSysctl(key, value)
+}
+
+// restore restores the previous values of modified kernel parameters
+func (b sysctlBackup) restore() error {
+	var errs []error
+	for key, value := range b {
+		if err := writeSysctl(key, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	clear(b)
+	return errors.Join(errs...)
+}
+
+// netnsGateway returns the gateway of the address family of ip
+func netnsGateway(ip netip.Addr) netip.Addr {
+	if ip.Is6() {
+		return NETNS_GATEWAY_IPV6
+	}
+	return NETNS_GATEWAY_IPV4
+}
+
+// freeVethName returns a name not used by the veth pair of another PDU Session; routingMu must be held
+func (t *TunManager) freeVethName() string {
+	used := make(map[string]struct{}, len(t.namespaces))
+	for _, ns := range t.namespaces {
+		used[ns.hostIface] = struct{}{}
+	}
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s%d-ns%d", NETNS_VETH_PREFIX, t.conf.Instance, i)
+		if _, ok := used[name]; !ok {
+			return name
+		}
+	}
+}
+
+// AddSessionNetns creates (or reuses) the named network namespace for this PDU Session.
+// The UE IP Addresses (IPv4v6 PDU Sessions have two of them) are configured in the namespace,
+// with a default route through a veth pair; packets are then forwarded by the host between the veth pair and the TUN interface.
+// The UE IP Addresses must not be configured on the TUN interface.
+func (t *TunManager) AddSessionNetns(ctx context.Context, ips []netip.Addr, name string) error {
+	if t.stack != nil {
+		return ErrUserspaceNetns
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+	unmapped := make([]netip.Addr, len(ips))
+	for i, ip := range ips {
+		unmapped[i] = ip.Unmap()
+	}
+	ips = unmapped
+	return t.do(func() error {
+		t.routingMu.Lock()
+		defer t.routingMu.Unlock()
+		if _, ok := t.namespaces[ips[0]]; ok {
+			return nil
+		}
+		// the interface in the namespace is named like the TUN interface
+		if name == t.conf.Netns {
+			return &NetnsError{Op: "use", Netns: name, Err: ErrNetnsInUse}
+		}
+		for _, ns := range t.namespaces {
+			if ns.name == name {
+				return &NetnsError{Op: "use", Netns: name, Err: ErrNetnsInUse}
+			}
+		}
+		ns := sessionNetns{
+			name:      name,
+			hostIface: t.freeVethName(),
+		}
+		created, err := setupSessionNetns(ns.name, ns.hostIface, t.name, t.mtu, ips, t.sysctls)
+		ns.created = created
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue-ip-addr": ips,
+				"netns":      name,
+			}).Error("Could not create network namespace for PDU Session")
+			if err := teardownSessionNetns(ns.name, ns.hostIface, ns.created); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"netns": name}).Warn("Could not remove network namespace")
+			}
+			t.restoreSysctls()
+			t.saveState()
+			return err
+		}
+		for _, ip := range ips {
+			t.namespaces[ip] = ns
+		}
+		t.saveState()
+		return nil
+	})
+}
+
+// SessionNetns returns the name of the network namespace of this PDU Session, if any
+func (t *TunManager) SessionNetns(ip netip.Addr) (string, bool) {
+	t.routingMu.Lock()
+	defer t.routingMu.Unlock()
+	ns, ok := t.namespaces[ip.Unmap()]
+	return ns.name, ok
+}
+
+// DelSessionNetns removes the network namespace of this PDU Session, if any
+func (t *TunManager) DelSessionNetns(ctx context.Context, ip netip.Addr) error {
+	return t.do(func() error {
+		ip = ip.Unmap()
+		t.routingMu.Lock()
+		defer t.routingMu.Unlock()
+		return t.delSessionNetns(ip)
+	})
+}
+
+// delSessionNetns removes the network namespace of this PDU Session, for all its UE IP Addresses; routingMu must be held
+func (t *TunManager) delSessionNetns(ip netip.Addr) error {
+	ns, ok := t.namespaces[ip]
+	if !ok {
+		return nil
+	}
+	maps.DeleteFunc(t.namespaces, func(_ netip.Addr, other sessionNetns) bool {
+		return other.hostIface == ns.hostIface
+	})
+	err := teardownSessionNetns(ns.name, ns.hostIface, ns.created)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"ue-ip-addr": ip,
+			"netns":      ns.name,
+		}).Error("Could not remove network namespace of PDU Session")
+	}
+	err = errors.Join(err, t.restoreSysctls())
+	t.saveState()
+	return err
+}
+
+// restoreSysctls restores the kernel parameters modified for network namespaces of PDU Sessions,
+// once there is no such namespace anymore; routingMu must be held
+func (t *TunManager) restoreSysctls() error {
+	if len(t.namespaces) > 0 {
+		return nil
+	}
+	if err := t.sysctls.restore(); err != nil {
+		logrus.WithError(err).Error("Could not restore kernel parameters")
+		return err
+	}
+	return nil
+}
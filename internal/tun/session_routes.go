@@ -0,0 +1,127 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package tun
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Metric of the routes of PDU Sessions, offset by their routing table: routes of the host
+// (including its default route) to the same destinations are preferred, and each PDU Session has its own routes.
+const SESSION_ROUTE_METRIC = 2000
+
+// sessionRouteMetric returns the metric of the routes of this PDU Session; routingMu must be held
+func (t *TunManager) sessionRouteMetric(ip netip.Addr) (int, bool) {
+	table, ok := t.routingTables[ip]
+	if !ok {
+		return 0, false
+	}
+	return SESSION_ROUTE_METRIC + table - ROUTING_TABLE_BASE, true
+}
+
+// AddSessionRoutes routes these destinations through the TUN interface, using the UE IP Address as source.
+// Routes are installed in the main table with a metric specific to the PDU Session: they are not used for destinations
+// also routed by the host with a lower metric (e.g. its default route, when `keep-default-route` is set).
+// AddSessionRouting must be called first. Destinations of the other address family are ignored.
+func (t *TunManager) AddSessionRoutes(ctx context.Context, ip netip.Addr, dsts []netip.Prefix) error {
+	if t.stack != nil {
+		if len(dsts) > 0 {
+			logrus.WithFields(logrus.Fields{"ue-ip-addr": ip}).Warn("Routes of PDU Sessions are ignored by the userspace network stack")
+		}
+		return nil
+	}
+	return t.do(func() error {
+		ip = ip.Unmap()
+		t.routingMu.Lock()
+		defer t.routingMu.Unlock()
+		metric, ok := t.sessionRouteMetric(ip)
+		if !ok && len(dsts) > 0 {
+			return ErrNoSessionRouting
+		}
+		installed := slices.Clone(t.sessionRoutes[ip])
+		for _, dst := range dsts {
+			dst = dst.Masked()
+			if dst.Addr().Is4() != ip.Is4() {
+				logrus.WithFields(logrus.Fields{
+					"ue-ip-addr": ip,
+					"dst":        dst,
+				}).Warn("Ignoring route of another address family than the PDU Session")
+				continue
+			}
+			if err := replaceSessionRoute(t.name, dst, ip, metric); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"ue-ip-addr": ip,
+					"dst":        dst,
+				}).Error("Could not add route for PDU Session")
+				t.sessionRoutes[ip] = installed
+				return err
+			}
+			if !slices.Contains(installed, dst) {
+				installed = append(installed, dst)
+			}
+		}
+		t.sessionRoutes[ip] = installed
+		return nil
+	})
+}
+
+// RefreshSessionRoutes installs again the routes of this PDU Session, e.g. after a handover
+func (t *TunManager) RefreshSessionRoutes(ctx context.Context, ip netip.Addr) error {
+	return t.do(func() error {
+		ip = ip.Unmap()
+		t.routingMu.Lock()
+		defer t.routingMu.Unlock()
+		metric, ok := t.sessionRouteMetric(ip)
+		if !ok {
+			return nil
+		}
+		for _, dst := range t.sessionRoutes[ip] {
+			if err := replaceSessionRoute(t.name, dst, ip, metric); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"ue-ip-addr": ip,
+					"dst":        dst,
+				}).Error("Could not refresh route of PDU Session")
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DelSessionRoutes removes the routes created by AddSessionRoutes for this PDU Session
+func (t *TunManager) DelSessionRoutes(ctx context.Context, ip netip.Addr) error {
+	return t.do(func() error {
+		ip = ip.Unmap()
+		t.routingMu.Lock()
+		defer t.routingMu.Unlock()
+		return t.delSessionRoutes(ip)
+	})
+}
+
+// delSessionRoutes removes the routes of this PDU Session; routingMu must be held, and the routing table must not be removed yet
+func (t *TunManager) delSessionRoutes(ip netip.Addr) error {
+	var err error
+	metric, ok := t.sessionRouteMetric(ip)
+	if !ok {
+		delete(t.sessionRoutes, ip)
+		return nil
+	}
+	for _, dst := range t.sessionRoutes[ip] {
+		if e := delSessionRoute(t.name, dst, ip, metric); e != nil {
+			logrus.WithError(e).WithFields(logrus.Fields{
+				"ue-ip-addr": ip,
+				"dst":        dst,
+			}).Error("Could not remove route of PDU Session")
+			err = e
+		}
+	}
+	delete(t.sessionRoutes, ip)
+	return err
+}
@@ -0,0 +1,104 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package tun
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Directory where each instance persists the state of network namespaces of PDU Sessions,
+// so it can be removed after a run that has not been shut down properly
+const STATE_DIR = "/run/nextmn-ue-lite"
+
+// state is the state of network namespaces of PDU Sessions that is not removed with the TUN interface
+type state struct {
+	Netns   []string     `json:"netns,omitempty"`   // network namespaces created for PDU Sessions
+	Sysctls sysctlBackup `json:"sysctls,omitempty"` // previous values of modified kernel parameters
+}
+
+// statePath returns the path of the state file of this instance
+func (t *TunManager) statePath() string {
+	return filepath.Join(STATE_DIR, fmt.Sprintf("instance-%d.json", t.conf.Instance))
+}
+
+// saveState persists the network namespaces created for PDU Sessions and the modified kernel parameters,
+// and removes the state file when there is none anymore; routingMu must be held
+func (t *TunManager) saveState() {
+	st := state{Sysctls: t.sysctls}
+	for _, ns := range t.namespaces {
+		if ns.created && !slices.Contains(st.Netns, ns.name) {
+			st.Netns = append(st.Netns, ns.name)
+		}
+	}
+	path := t.statePath()
+	if len(st.Netns) == 0 && len(st.Sysctls) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logrus.WithError(err).WithFields(logrus.Fields{"path": path}).Warn("Could not remove state file")
+		}
+		return
+	}
+	if err := writeState(path, st); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"path": path}).Warn("Could not save state file: network namespaces and kernel parameters will not be restored after a crash")
+	}
+}
+
+// writeState atomically replaces the state file
+func writeState(path string, st state) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// restoreState removes the network namespaces of PDU Sessions and restores the kernel parameters
+// left by a previous run of this instance, as persisted in its state file
+func (t *TunManager) restoreState() error {
+	path := t.statePath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return &ReconcileError{Op: "read state file " + path, Err: err}
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return &ReconcileError{Op: "read state file " + path, Err: err}
+	}
+	for _, name := range st.Netns {
+		logrus.WithFields(logrus.Fields{"netns": name}).Info("Removing leftover network namespace")
+		if err := deleteNetns(name); err != nil {
+			return err
+		}
+	}
+	for key, value := range st.Sysctls {
+		logrus.WithFields(logrus.Fields{"key": key, "value": value}).Info("Restoring leftover kernel parameter")
+		// parameters of removed interfaces do not exist anymore
+		if err := writeSysctl(key, value); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return &ReconcileError{Op: "restore kernel parameter", Err: err}
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		return &ReconcileError{Op: "remove state file " + path, Err: err}
+	}
+	return nil
+}
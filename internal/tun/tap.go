@@ -0,0 +1,70 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package tun
+
+import (
+	"context"
+	"net"
+
+	"github.com/nextmn/ue-lite/internal/common"
+
+	"github.com/sirupsen/logrus"
+	"github.com/songgao/water"
+)
+
+// Maximum size of an Ethernet frame read from the TAP interface (802.1Q header + payload)
+const TAP_FRAME_MAX = TUN_MTU_MAX + 18
+
+// Get the tap interface used by Ethernet PDU Sessions, or nil if there is none.
+// Don't forget to run CloseTap when no longer in use
+func (t *TunManager) OpenTap() *water.Interface {
+	t.used.Add(1)
+	return t.tap
+}
+
+func (t *TunManager) CloseTap() {
+	t.used.Done()
+}
+
+// TapHardwareAddr returns the MAC address of the TAP interface
+func (t *TunManager) TapHardwareAddr() (common.MacAddr, error) {
+	if t.tap == nil {
+		return common.MacAddr{}, ErrNoTapIface
+	}
+	var iface *net.Interface
+	if err := t.do(func() error {
+		i, err := net.InterfaceByName(t.tap.Name())
+		iface = i
+		return err
+	}); err != nil {
+		return common.MacAddr{}, err
+	}
+	m, ok := common.MacAddrFromSlice(iface.HardwareAddr)
+	if !ok {
+		return common.MacAddr{}, common.ErrInvalidMacAddr
+	}
+	return m, nil
+}
+
+func newTapIface(ctx context.Context, name string, mtu int) (*water.Interface, error) {
+	config := water.Config{
+		DeviceType:             water.TAP,
+		PlatformSpecificParams: platformSpecificParams(name, false),
+	}
+	iface, err := water.New(config)
+	if err != nil {
+		logrus.WithError(err).Error("Unable to allocate TAP interface")
+		return nil, err
+	}
+	if err := setupLink(iface.Name(), mtu); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"mtu":       mtu,
+			"interface": iface.Name(),
+		}).Error("Unable to set up interface")
+		return nil, err
+	}
+	return iface, nil
+}
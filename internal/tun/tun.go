@@ -6,38 +6,108 @@
 package tun
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"net/netip"
-	"strconv"
 	"sync"
 
+	"github.com/nextmn/ue-lite/internal/config"
+	"github.com/nextmn/ue-lite/internal/netstack"
+
 	"github.com/sirupsen/logrus"
 	"github.com/songgao/water"
 )
 
 const (
-	TUN_NAME = "nextmn-ue-lite"
-	TUN_MTU  = 1400
+	TUN_NAME    = "nextmn-ue-lite"
+	TUN_MTU     = 1400
+	TUN_MTU_MAX = 9000 // jumbo frames
+	TAP_NAME    = "nextmn-ue-eth"
+
+	// Default names of the interfaces of instances other than 0 (at most 15 characters)
+	TUN_NAME_INSTANCE = "nextmn-ue%d"
+	TAP_NAME_INSTANCE = "nextmn-eth%d"
+
+	// Protocol of routes and rules created by ue-lite (not registered in iproute2's rt_protos)
+	ROUTE_PROTOCOL = 110
+
+	// IPv6 PDU Sessions are allocated a /64 prefix (3GPP TS 23.501 §5.8.2.2.2)
+	IPV6_PREFIX_LEN = 64
 )
 
 type TunManager struct {
-	ready  bool
-	name   string
-	tun    *water.Interface
+	ready    bool
+	name     string
+	tapName  string
+	mtu      int
+	tun      []io.ReadWriter // one per queue
+	queues   int
+	ethernet bool
+	tap      *water.Interface
+	conf     config.Tun
+	fw       Firewall
+	stack    *netstack.Stack // userspace network stack, used instead of the TUN interface
+
+	netnsCreated bool // the network namespace of the TUN interface was created by the TunManager
+
 	closed chan struct{}
 	used   sync.WaitGroup
+
+	routingMu     sync.Mutex
+	addrs         map[netip.Addr]struct{}       // UE IP Addresses configured on the TUN interface
+	routingTables map[netip.Addr]int            // key: UE IP Address; value: routing table of the PDU Session
+	sessionRoutes map[netip.Addr][]netip.Prefix // key: UE IP Address; value: destinations routed through the PDU Session
+	namespaces    map[netip.Addr]sessionNetns   // key: UE IP Address; value: network namespace of the PDU Session
+	sysctls       sysctlBackup                  // kernel parameters modified for network namespaces of PDU Sessions
 }
 
-func NewTunManager() *TunManager {
+// NewTunManager creates a TunManager. When ethernet is true,
+// a TAP interface is also created for Ethernet PDU Sessions.
+// When queues is greater than 1, the TUN interface is created with multiple queues (Linux only).
+// Interface names default to TUN_NAME and TAP_NAME for the instance 0, else to TUN_NAME_INSTANCE and TAP_NAME_INSTANCE;
+// the MTU defaults to TUN_MTU.
+// When conf.Userspace is true, a userspace network stack is used instead of the TUN interface.
+func NewTunManager(ethernet bool, queues int, conf config.Tun) *TunManager {
+	queues = max(queues, 1)
+	if queues > 1 && conf.Userspace {
+		logrus.WithFields(logrus.Fields{"queues": queues}).Warn("The userspace network stack has a single queue")
+		queues = 1
+	}
+	if queues > 1 && !multiQueueSupported {
+		logrus.WithFields(logrus.Fields{"queues": queues}).Warn("Multi-queue TUN interfaces are not supported on this platform, using a single queue")
+		queues = 1
+	}
 	return &TunManager{
-		closed: make(chan struct{}),
+		name:     cmp.Or(conf.Name, defaultName(TUN_NAME, TUN_NAME_INSTANCE, conf.Instance)),
+		tapName:  cmp.Or(conf.TapName, defaultName(TAP_NAME, TAP_NAME_INSTANCE, conf.Instance)),
+		mtu:      cmp.Or(conf.Mtu, TUN_MTU),
+		queues:   queues,
+		ethernet: ethernet,
+		conf:     conf,
+		closed:   make(chan struct{}),
+
+		addrs:         make(map[netip.Addr]struct{}),
+		routingTables: make(map[netip.Addr]int),
+		sessionRoutes: make(map[netip.Addr][]netip.Prefix),
+		namespaces:    make(map[netip.Addr]sessionNetns),
+		sysctls:       make(sysctlBackup),
+	}
+}
+
+// defaultName returns the default name of an interface of this instance
+func defaultName(name string, format string, instance uint16) string {
+	if instance == 0 {
+		return name
 	}
+	return fmt.Sprintf(format, instance)
 }
 
-// Get a tun interface.
+// Get the queues of the tun interface; packets of a given flow are always read from the same queue.
 // Don't forget to run CloseTun when no longer in use
-func (t *TunManager) OpenTun() *water.Interface {
+func (t *TunManager) OpenTun() []io.ReadWriter {
 	t.used.Add(1)
 	return t.tun
 }
@@ -47,25 +117,153 @@ func (t *TunManager) CloseTun() {
 }
 
 func (t *TunManager) Start(ctx context.Context) error {
-	tun, err := newTunIface(ctx)
-	t.tun = tun
-	if err != nil {
+	if t.conf.Userspace {
+		return t.startUserspace(ctx)
+	}
+	if t.conf.Netns != "" {
+		created, err := createNetns(t.conf.Netns)
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"netns": t.conf.Netns}).Error("Unable to create network namespace")
+			return err
+		}
+		t.netnsCreated = created
+		logrus.WithFields(logrus.Fields{"netns": t.conf.Netns, "created": created}).Info("Using network namespace for the TUN interface")
+	}
+	if err := t.do(func() error { return t.setup(ctx) }); err != nil {
 		return err
 	}
-	t.name = t.tun.Name()
 	t.ready = true
 	go func(ctx context.Context) {
 		<-ctx.Done()
 		t.used.Wait() // Do not delete tun iface until all tuns are closed
 
 		ctxDel := context.WithoutCancel(ctx) // required to force cleanup
-		if err := runIPTables(ctxDel, "-D", "OUTPUT", "-o", t.name, "-p", "icmp", "--icmp-type", "redirect", "-j", "DROP"); err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{"interface": t.name}).Error("Error while removing iptables rules")
+		t.do(func() error {
+			t.cleanup(ctxDel)
+			return nil
+		})
+		if t.netnsCreated {
+			if err := deleteNetns(t.conf.Netns); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"netns": t.conf.Netns}).Error("Error while removing network namespace")
+			}
 		}
 		t.ready = false
 		close(t.closed)
 	}(ctx)
-	return err
+	return nil
+}
+
+// setup creates the interfaces and firewall rules
+func (t *TunManager) setup(ctx context.Context) error {
+	if t.mtu <= 0 || t.mtu > TUN_MTU_MAX {
+		logrus.WithFields(logrus.Fields{"mtu": t.mtu, "max": TUN_MTU_MAX}).Error("Invalid MTU")
+		return ErrInvalidMtu
+	}
+	fw, err := NewFirewall(t.conf.Firewall, t.firewallTable())
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"backend": t.conf.Firewall}).Error("Unable to select firewall backend")
+		return err
+	}
+	logrus.WithFields(logrus.Fields{"backend": fw.Backend()}).Info("Using firewall backend")
+	t.fw = fw
+	if err := t.reconcile(); err != nil {
+		logrus.WithError(err).Error("Unable to remove leftovers of a previous run")
+		return err
+	}
+	if t.conf.Netns != "" {
+		if err := setLinkUp("lo"); err != nil {
+			return err
+		}
+	}
+	tun, err := newTunIface(ctx, t.name, t.mtu, t.queues, !t.conf.KeepDefaultRoute)
+	if err != nil {
+		return err
+	}
+	for _, iface := range tun {
+		t.tun = append(t.tun, iface)
+	}
+	t.name = tun[0].Name()
+	if err := fw.Init(ctx); err != nil {
+		logrus.WithError(err).Error("Unable to create firewall table")
+		return err
+	}
+	if err := fw.DropIcmpRedirects(ctx, t.name); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"interface": t.name}).Error("Error while setting firewall rule to drop icmp redirects")
+		return err
+	}
+	if t.ethernet {
+		tap, err := newTapIface(ctx, t.tapName, t.mtu)
+		if err != nil {
+			return err
+		}
+		t.tap = tap
+	}
+	return nil
+}
+
+// reconcile removes the state left by a previous run of this instance that has not been shut down properly,
+// including network namespaces of PDU Sessions and kernel parameters persisted in its state file.
+// Rules of the firewall table are removed when the table is initialized.
+func (t *TunManager) reconcile() error {
+	tableMin := t.routingTableMin()
+	ifaces := []string{t.name}
+	if t.ethernet {
+		ifaces = append(ifaces, t.tapName)
+	}
+	if err := cleanupLeftovers(leftovers{
+		ifaces:     ifaces,
+		vethPrefix: fmt.Sprintf("%s%d-ns", NETNS_VETH_PREFIX, t.conf.Instance),
+		tableMin:   tableMin,
+		tableMax:   tableMin + ROUTING_TABLES_PER_INSTANCE - 1,
+	}); err != nil {
+		return err
+	}
+	return t.restoreState()
+}
+
+// cleanup removes the routes, routing rules, addresses and firewall rules created by this instance
+func (t *TunManager) cleanup(ctx context.Context) {
+	t.cleanupSessionRouting()
+	t.routingMu.Lock()
+	for ip := range t.addrs {
+		if err := delAddr(t.name, netip.PrefixFrom(ip, prefixLen(ip))); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"ue-ip-addr": ip}).Error("Error while removing ip address")
+		}
+	}
+	clear(t.addrs)
+	t.routingMu.Unlock()
+	if !t.conf.KeepDefaultRoute {
+		for _, dst := range defaultPrefixes() {
+			if err := delRoute(t.name, dst, 0); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"dst": dst}).Error("Error while removing default route")
+			}
+		}
+	}
+	if err := t.fw.Cleanup(ctx); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"interface": t.name}).Error("Error while removing firewall rules")
+	}
+}
+
+// firewallTable returns the name of the firewall table of this instance
+func (t *TunManager) firewallTable() string {
+	if t.conf.Instance == 0 {
+		return FIREWALL_TABLE_NAME
+	}
+	return fmt.Sprintf("%s-%d", FIREWALL_TABLE_NAME, t.conf.Instance)
+}
+
+// do runs f in the network namespace of the TUN interface
+func (t *TunManager) do(f func() error) error {
+	if t.conf.Netns == "" {
+		return f()
+	}
+	return inNetns(t.conf.Netns, f)
+}
+
+// InNetns runs f with the current thread in the named network namespace,
+// e.g. to check the TUN interface can be configured in it
+func InNetns(name string, f func() error) error {
+	return inNetns(name, f)
 }
 
 func (t *TunManager) WaitShutdown(ctx context.Context) error {
@@ -80,60 +278,163 @@ func (t *TunManager) WaitShutdown(ctx context.Context) error {
 	}
 }
 
-func newTunIface(ctx context.Context) (*water.Interface, error) {
+// newTunIface creates the TUN interface; when defaultRoute is true, the default routes of the host are replaced by routes through it
+func newTunIface(ctx context.Context, name string, mtu int, queues int, defaultRoute bool) ([]*water.Interface, error) {
 	config := water.Config{
 		DeviceType:             water.TUN,
-		PlatformSpecificParams: platformSpecificParams(),
+		PlatformSpecificParams: platformSpecificParams(name, queues > 1),
 	}
-	iface, err := water.New(config)
-	if err != nil {
-		logrus.WithError(err).Error("Unable to allocate TUN interface")
-		return nil, err
+	ifaces := make([]*water.Interface, 0, queues)
+	for range queues {
+		iface, err := water.New(config)
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"queue": len(ifaces)}).Error("Unable to allocate TUN interface")
+			for _, i := range ifaces {
+				i.Close()
+			}
+			return nil, err
+		}
+		ifaces = append(ifaces, iface)
 	}
-	if err := runIP(ctx, "link", "set", "dev", iface.Name(), "mtu", strconv.Itoa(TUN_MTU)); err != nil {
+	iface := ifaces[0]
+	if err := setupLink(iface.Name(), mtu); err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
-			"mtu":       TUN_MTU,
+			"mtu":       mtu,
 			"interface": iface.Name(),
-		}).Error("Unable to set MTU")
+		}).Error("Unable to set up interface")
 		return nil, err
 	}
-	if err := runIP(ctx, "link", "set", "dev", iface.Name(), "up"); err != nil {
-		logrus.WithError(err).WithFields(logrus.Fields{
-			"interface": iface.Name(),
-		}).Error("Unable to set interface up")
-		return nil, err
+	if !defaultRoute {
+		return ifaces, nil
 	}
-	// TODO: add proto "nextmn-lite-ue"
-	if err := runIP(ctx, "route", "replace", "default", "dev", iface.Name()); err != nil {
-		logrus.WithError(err).WithFields(logrus.Fields{
-			"interface": iface.Name(),
-		}).Error("Unable to set default route")
-		return nil, err
+	for _, dst := range defaultPrefixes() {
+		if err := replaceRoute(iface.Name(), dst, netip.Addr{}, 0); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"interface": iface.Name(),
+				"dst":       dst,
+			}).Error("Unable to set default route")
+			return nil, err
+		}
 	}
-	if err := runIPTables(ctx, "-A", "OUTPUT", "-o", iface.Name(), "-p", "icmp", "--icmp-type", "redirect", "-j", "DROP"); err != nil {
-		logrus.WithError(err).WithFields(logrus.Fields{"interface": iface.Name()}).Error("Error while setting iptable rule to drop icmp redirects")
-		return nil, err
+	return ifaces, nil
+}
+
+// defaultPrefixes returns the IPv4 and IPv6 default destinations
+func defaultPrefixes() []netip.Prefix {
+	return []netip.Prefix{
+		netip.PrefixFrom(netip.IPv4Unspecified(), 0),
+		netip.PrefixFrom(netip.IPv6Unspecified(), 0),
 	}
-	return iface, nil
+}
+
+// prefixLen returns the prefix length used when the address is configured on the interface
+func prefixLen(ip netip.Addr) int {
+	if ip.Is6() {
+		return IPV6_PREFIX_LEN
+	}
+	return ip.BitLen()
 }
 
 func (t *TunManager) DelIp(ctx context.Context, ip netip.Addr) error {
-	if err := runIP(ctx, "addr", "del", fmt.Sprintf("%s/%d", ip.String(), ip.BitLen()), "dev", TUN_NAME); err != nil {
-		logrus.WithError(err).WithFields(logrus.Fields{
-			"ue-ip-addr": ip,
-			"dev":        TUN_NAME,
-		}).Error("Could not remove ip address")
-		return err
+	if t.stack != nil {
+		return t.stack.DelAddr(ip.Unmap())
 	}
-	return nil
+	return t.do(func() error {
+		ip = ip.Unmap()
+		if err := delAddr(t.name, netip.PrefixFrom(ip, prefixLen(ip))); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue-ip-addr": ip,
+				"dev":        t.name,
+			}).Error("Could not remove ip address")
+			return err
+		}
+		t.routingMu.Lock()
+		delete(t.addrs, ip)
+		t.routingMu.Unlock()
+		return nil
+	})
 }
+
 func (t *TunManager) AddIp(ctx context.Context, ip netip.Addr) error {
-	if err := runIP(ctx, "addr", "add", fmt.Sprintf("%s/%d", ip.String(), ip.BitLen()), "dev", TUN_NAME); err != nil {
-		logrus.WithError(err).WithFields(logrus.Fields{
-			"ue-ip-addr": ip,
-			"dev":        TUN_NAME,
-		}).Error("Could not add ip address for new PDU Session")
+	if t.stack != nil {
+		ip = ip.Unmap()
+		if err := t.stack.AddAddr(netip.PrefixFrom(ip, prefixLen(ip))); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"ue-ip-addr": ip}).Error("Could not add ip address for new PDU Session")
+			return err
+		}
+		return nil
+	}
+	return t.do(func() error {
+		ip = ip.Unmap()
+		if err := addAddr(t.name, netip.PrefixFrom(ip, prefixLen(ip))); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue-ip-addr": ip,
+				"dev":        t.name,
+			}).Error("Could not add ip address for new PDU Session")
+			return err
+		}
+		t.routingMu.Lock()
+		t.addrs[ip] = struct{}{}
+		t.routingMu.Unlock()
+		return nil
+	})
+}
+
+// DialContext connects to dst in the Data Network, using the UE IP Address src as source; network is "tcp", "udp" or "icmp".
+// ICMP connections send and receive ICMP messages, header included (the port of dst is ignored).
+// The connection is created in the network namespace of the PDU Session, if any.
+func (t *TunManager) DialContext(ctx context.Context, network string, src netip.Addr, dst netip.AddrPort) (net.Conn, error) {
+	src = src.Unmap()
+	if t.stack != nil {
+		return t.stack.DialContext(ctx, network, src, dst)
+	}
+	dialer := net.Dialer{}
+	switch network {
+	case "tcp":
+		dialer.LocalAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, 0))
+	case "udp":
+		dialer.LocalAddr = net.UDPAddrFromAddrPort(netip.AddrPortFrom(src, 0))
+	case "icmp":
+		dialer.LocalAddr = &net.IPAddr{IP: src.AsSlice()}
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	var conn net.Conn
+	dial := func() error {
+		if network == "icmp" {
+			c, err := dialIcmp(ctx, dialer, dst.Addr().Unmap())
+			conn = c
+			return err
+		}
+		c, err := dialer.DialContext(ctx, network, dst.String())
+		conn = c
 		return err
 	}
-	return nil
+	if netns, ok := t.SessionNetns(src); ok {
+		return conn, inNetns(netns, dial)
+	}
+	return conn, t.do(dial)
+}
+
+// icmpConn is a raw ICMP socket whose reads do not include the IP header
+type icmpConn struct {
+	*net.IPConn
+}
+
+func (c icmpConn) Read(b []byte) (int, error) {
+	n, _, err := c.IPConn.ReadFrom(b)
+	return n, err
+}
+
+// dialIcmp creates a raw ICMP socket connected to dst
+func dialIcmp(ctx context.Context, dialer net.Dialer, dst netip.Addr) (net.Conn, error) {
+	network := "ip4:icmp"
+	if dst.Is6() {
+		network = "ip6:ipv6-icmp"
+	}
+	c, err := dialer.DialContext(ctx, network, dst.String())
+	if err != nil {
+		return nil, err
+	}
+	return icmpConn{c.(*net.IPConn)}, nil
 }
@@ -0,0 +1,19 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build darwin
+
+package tun
+
+import "github.com/songgao/water"
+
+// multi-queue TUN interfaces are not supported
+const multiQueueSupported = false
+
+func platformSpecificParams(name string, _ bool) water.PlatformSpecificParams {
+	return water.PlatformSpecificParams{
+		Name: name,
+	}
+}
@@ -3,14 +3,17 @@
 // found in the LICENSE file.
 // SPDX-License-Identifier: MIT
 
-//go:build linux || darwin
+//go:build linux
 
 package tun
 
 import "github.com/songgao/water"
 
-func platformSpecificParams() water.PlatformSpecificParams {
+const multiQueueSupported = true
+
+func platformSpecificParams(name string, multiQueue bool) water.PlatformSpecificParams {
 	return water.PlatformSpecificParams{
-		Name: TUN_NAME,
+		Name:       name,
+		MultiQueue: multiQueue,
 	}
 }
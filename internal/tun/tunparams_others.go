@@ -9,6 +9,9 @@ package tun
 
 import "github.com/songgao/water"
 
-func platformSpecificParams() water.PlatformSpecificParams {
+// multi-queue TUN interfaces are not supported
+const multiQueueSupported = false
+
+func platformSpecificParams(name string, _ bool) water.PlatformSpecificParams {
 	return water.PlatformSpecificParams{}
 }
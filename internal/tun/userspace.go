@@ -0,0 +1,47 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package tun
+
+import (
+	"context"
+	"io"
+
+	"github.com/nextmn/ue-lite/internal/netstack"
+
+	"github.com/sirupsen/logrus"
+)
+
+// startUserspace creates the userspace network stack used instead of the TUN interface;
+// neither the host routes nor its firewall are modified.
+func (t *TunManager) startUserspace(ctx context.Context) error {
+	if t.ethernet {
+		return ErrUserspaceEthernet
+	}
+	if t.conf.Netns != "" {
+		return ErrUserspaceNetns
+	}
+	if t.mtu <= 0 || t.mtu > TUN_MTU_MAX {
+		logrus.WithFields(logrus.Fields{"mtu": t.mtu, "max": TUN_MTU_MAX}).Error("Invalid MTU")
+		return ErrInvalidMtu
+	}
+	stack, err := netstack.NewStack(t.mtu)
+	if err != nil {
+		logrus.WithError(err).Error("Unable to create userspace network stack")
+		return err
+	}
+	t.stack = stack
+	t.tun = []io.ReadWriter{stack}
+	logrus.Info("Using userspace network stack")
+	t.ready = true
+	go func(ctx context.Context) {
+		<-ctx.Done()
+		t.used.Wait()
+		t.stack.Close()
+		t.ready = false
+		close(t.closed)
+	}(ctx)
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package twamp
+
+import (
+	"cmp"
+	"math"
+	"net/netip"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/common"
+	"github.com/nextmn/ue-lite/internal/tun"
+)
+
+const (
+	DEFAULT_INTERVAL = 100 * time.Millisecond
+	DEFAULT_SIZE     = REFLECTOR_PACKET_LEN
+	DEFAULT_TIMEOUT  = time.Second
+)
+
+// TestConfig describes a TWAMP-Light test session from the UE IP Address of a PDU Session to a reflector in the Data Network
+type TestConfig struct {
+	Dnn  string     `json:"dnn,omitempty"`     // DNN of the PDU Session
+	Addr netip.Addr `json:"address,omitempty"` // UE IP Address of the PDU Session (instead of the DNN)
+
+	Target   string          `json:"target"`             // reflector: `ip:port`, or `ip` (port 862)
+	Interval common.Duration `json:"interval,omitempty"` // interval between test packets (default: 100ms)
+	Count    uint64          `json:"count,omitempty"`    // the session stops after this number of test packets, at most 2^32 - 1 (default: when stopped)
+	Duration common.Duration `json:"duration,omitempty"` // the session stops after this duration (default: when stopped)
+	Size     int             `json:"size,omitempty"`     // size of test packets, padding included, UDP header excluded (default and minimum: 41)
+	Timeout  common.Duration `json:"timeout,omitempty"`  // test packets not reflected after this delay are lost (default: 1s)
+}
+
+// withDefaults returns the configuration with default values set
+func (c TestConfig) withDefaults() TestConfig {
+	c.Interval = cmp.Or(c.Interval, common.Duration(DEFAULT_INTERVAL))
+	c.Size = cmp.Or(c.Size, DEFAULT_SIZE)
+	c.Timeout = cmp.Or(c.Timeout, common.Duration(DEFAULT_TIMEOUT))
+	return c
+}
+
+// target returns the address of the reflector
+func (c TestConfig) target() (netip.AddrPort, error) {
+	if ap, err := netip.ParseAddrPort(c.Target); err == nil {
+		return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()), nil
+	}
+	if addr, err := netip.ParseAddr(c.Target); err == nil {
+		return netip.AddrPortFrom(addr.Unmap(), TWAMP_PORT), nil
+	}
+	return netip.AddrPort{}, ErrInvalidTarget
+}
+
+// validate checks the configuration (with defaults set) can be used from this UE IP Address
+func (c TestConfig) validate(ueIp netip.Addr, target netip.AddrPort) error {
+	if target.Addr().Is4() != ueIp.Is4() {
+		return ErrAddressFamily
+	}
+	// reflectors ignore shorter packets, so they cannot be used for amplification
+	if c.Size < REFLECTOR_PACKET_LEN || c.Size > tun.TUN_MTU_MAX {
+		return ErrInvalidSize
+	}
+	// sequence numbers are 32 bits long
+	if c.Interval <= 0 || c.Timeout <= 0 || c.Duration < 0 || c.Count > math.MaxUint32 {
+		return ErrInvalidConfig
+	}
+	return nil
+}
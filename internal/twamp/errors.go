@@ -0,0 +1,17 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package twamp
+
+import "errors"
+
+var (
+	ErrShortPacket     = errors.New("test packet too short")
+	ErrInvalidTarget   = errors.New("invalid target: use `ip:port` (port 862 if omitted)")
+	ErrAddressFamily   = errors.New("the target is not of the address family of the PDU Session")
+	ErrInvalidSize     = errors.New("invalid packet size: the minimum is 41 bytes")
+	ErrInvalidConfig   = errors.New("invalid interval, count, duration or timeout")
+	ErrSessionNotFound = errors.New("no test session found with this id")
+)
@@ -0,0 +1,109 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package twamp
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	// Well-known port of TWAMP-Test (RFC 8545)
+	TWAMP_PORT = 862
+
+	// Length of an unauthenticated Session-Sender test packet, without padding (RFC 5357, section 4.1.2)
+	SENDER_PACKET_LEN = 14
+
+	// Length of an unauthenticated Session-Reflector test packet, without padding (RFC 5357, section 4.2.1).
+	// Sender packets of at least this length are reflected with the same length (RFC 6038); shorter ones are ignored.
+	REFLECTOR_PACKET_LEN = 41
+
+	// Error Estimate of timestamps (RFC 4656, section 4.1.2): not synchronized to UTC, NTP format, multiplier 1
+	ERROR_ESTIMATE = 0x0001
+
+	// TTL of test packets (RFC 5357, section 4.2.1)
+	TEST_TTL = 255
+
+	// Seconds between the NTP epoch (1900) and the Unix epoch (1970)
+	ntpEpochOffset = 2208988800
+)
+
+// ntpTimestamp returns t in the 64 bits NTP format
+func ntpTimestamp(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := (uint64(t.Nanosecond()) << 32) / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+// ntpTime returns the time of a timestamp in the 64 bits NTP format
+func ntpTime(ts uint64) time.Time {
+	secs := int64(ts>>32) - ntpEpochOffset
+	nsecs := ((ts & 0xffffffff) * uint64(time.Second)) >> 32
+	return time.Unix(secs, int64(nsecs))
+}
+
+// senderPacket is an unauthenticated Session-Sender test packet
+type senderPacket struct {
+	seq       uint32
+	timestamp time.Time
+}
+
+// encode writes the packet at the beginning of b; the remaining bytes are padding
+func (p senderPacket) encode(b []byte) {
+	binary.BigEndian.PutUint32(b[0:], p.seq)
+	binary.BigEndian.PutUint64(b[4:], ntpTimestamp(p.timestamp))
+	binary.BigEndian.PutUint16(b[12:], ERROR_ESTIMATE)
+	clear(b[SENDER_PACKET_LEN:])
+}
+
+func decodeSenderPacket(b []byte) (senderPacket, error) {
+	if len(b) < SENDER_PACKET_LEN {
+		return senderPacket{}, ErrShortPacket
+	}
+	return senderPacket{
+		seq:       binary.BigEndian.Uint32(b[0:]),
+		timestamp: ntpTime(binary.BigEndian.Uint64(b[4:])),
+	}, nil
+}
+
+// reflectorPacket is an unauthenticated Session-Reflector test packet
+type reflectorPacket struct {
+	seq             uint32
+	timestamp       time.Time // transmission by the reflector
+	receiveTime     time.Time // reception of the sender packet by the reflector
+	senderSeq       uint32
+	senderTimestamp time.Time
+	senderTTL       uint8 // TTL (or Hop Limit) of the sender packet, when received by the reflector
+}
+
+// encode writes the packet at the beginning of b; the remaining bytes are padding
+func (p reflectorPacket) encode(b []byte, senderErrorEstimate uint16) {
+	binary.BigEndian.PutUint32(b[0:], p.seq)
+	binary.BigEndian.PutUint64(b[4:], ntpTimestamp(p.timestamp))
+	binary.BigEndian.PutUint16(b[12:], ERROR_ESTIMATE)
+	binary.BigEndian.PutUint16(b[14:], 0) // MBZ
+	binary.BigEndian.PutUint64(b[16:], ntpTimestamp(p.receiveTime))
+	binary.BigEndian.PutUint32(b[24:], p.senderSeq)
+	binary.BigEndian.PutUint64(b[28:], ntpTimestamp(p.senderTimestamp))
+	binary.BigEndian.PutUint16(b[36:], senderErrorEstimate)
+	binary.BigEndian.PutUint16(b[38:], 0) // MBZ
+	b[40] = p.senderTTL
+	clear(b[REFLECTOR_PACKET_LEN:])
+}
+
+func decodeReflectorPacket(b []byte) (reflectorPacket, error) {
+	if len(b) < REFLECTOR_PACKET_LEN {
+		return reflectorPacket{}, ErrShortPacket
+	}
+	return reflectorPacket{
+		seq:             binary.BigEndian.Uint32(b[0:]),
+		timestamp:       ntpTime(binary.BigEndian.Uint64(b[4:])),
+		receiveTime:     ntpTime(binary.BigEndian.Uint64(b[16:])),
+		senderSeq:       binary.BigEndian.Uint32(b[24:]),
+		senderTimestamp: ntpTime(binary.BigEndian.Uint64(b[28:])),
+		senderTTL:       b[40],
+	}, nil
+}
@@ -0,0 +1,134 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package twamp
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Maximum size of a received test packet
+const RECEIVE_MAX = 65535
+
+// Reflector is a stateless TWAMP-Light Session-Reflector: test packets are sent back to their sender,
+// with timestamps and the sequence number of the sender (RFC 5357, appendix I)
+type Reflector struct {
+	listen netip.AddrPort
+	closed chan struct{}
+}
+
+func NewReflector(listen netip.AddrPort) *Reflector {
+	return &Reflector{
+		listen: listen,
+		closed: make(chan struct{}),
+	}
+}
+
+// Start listens for test packets until ctx is done
+func (r *Reflector) Start(ctx context.Context) error {
+	conn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(r.listen))
+	if err != nil {
+		return err
+	}
+	read := r.ttlReader(conn)
+	logrus.WithFields(logrus.Fields{"listen": r.listen}).Info("TWAMP-Light reflector started")
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer close(r.closed)
+		buf := make([]byte, RECEIVE_MAX)
+		for {
+			n, ttl, src, err := read(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logrus.WithError(err).Debug("Could not receive test packet")
+				continue
+			}
+			r.reflect(conn, buf, n, ttl, src)
+		}
+	}()
+	return nil
+}
+
+// WaitShutdown waits for the reflector to be stopped
+func (r *Reflector) WaitShutdown(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.closed:
+		return nil
+	}
+}
+
+// reflect answers the sender packet of length n at the beginning of buf
+func (r *Reflector) reflect(conn *net.UDPConn, buf []byte, n int, ttl uint8, src net.Addr) {
+	received := time.Now()
+	// the answer must not be larger than the test packet: it could be used for amplification, e.g. with a spoofed source
+	if n < REFLECTOR_PACKET_LEN {
+		logrus.WithFields(logrus.Fields{"sender": src, "length": n}).Debug("Test packet too short to be reflected")
+		return
+	}
+	req, err := decodeSenderPacket(buf[:n])
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"sender": src}).Debug("Invalid test packet")
+		return
+	}
+	senderErrorEstimate := binary.BigEndian.Uint16(buf[12:])
+	resp := reflectorPacket{
+		seq:             req.seq,
+		receiveTime:     received,
+		senderSeq:       req.seq,
+		senderTimestamp: req.timestamp,
+		senderTTL:       ttl,
+	}
+	// symmetrical size (RFC 6038): the padding of the sender is truncated by the length of the additional fields
+	resp.timestamp = time.Now()
+	resp.encode(buf[:n], senderErrorEstimate)
+	if _, err := conn.WriteTo(buf[:n], src); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"sender": src}).Debug("Could not reflect test packet")
+	}
+}
+
+// ttlReader returns a function reading packets with their TTL (or Hop Limit); TEST_TTL is used when it is not available
+func (r *Reflector) ttlReader(conn *net.UDPConn) func(b []byte) (int, uint8, net.Addr, error) {
+	if r.listen.Addr().Unmap().Is4() {
+		pc := ipv4.NewPacketConn(conn)
+		if err := pc.SetControlMessage(ipv4.FlagTTL, true); err != nil {
+			logrus.WithError(err).Debug("TTL of test packets is not available")
+		}
+		pc.SetTTL(TEST_TTL)
+		return func(b []byte) (int, uint8, net.Addr, error) {
+			n, cm, src, err := pc.ReadFrom(b)
+			if cm == nil || cm.TTL == 0 {
+				return n, TEST_TTL, src, err
+			}
+			return n, uint8(cm.TTL), src, err
+		}
+	}
+	pc := ipv6.NewPacketConn(conn)
+	if err := pc.SetControlMessage(ipv6.FlagHopLimit, true); err != nil {
+		logrus.WithError(err).Debug("Hop Limit of test packets is not available")
+	}
+	pc.SetHopLimit(TEST_TTL)
+	return func(b []byte) (int, uint8, net.Addr, error) {
+		n, cm, src, err := pc.ReadFrom(b)
+		if cm == nil || cm.HopLimit == 0 {
+			return n, TEST_TTL, src, err
+		}
+		return n, uint8(cm.HopLimit), src, err
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package twamp
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/nextmn/ue-lite/internal/common"
+	"github.com/nextmn/ue-lite/internal/session"
+	"github.com/nextmn/ue-lite/internal/tun"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Sender runs TWAMP-Light test sessions over PDU Sessions
+type Sender struct {
+	common.WithContext
+
+	ps     *session.PduSessions
+	tunMan *tun.TunManager
+
+	mu       sync.Mutex
+	sessions map[uint32]*testSession
+	nextId   uint32
+}
+
+type TestSessionIdMsg struct {
+	Id uint32 `json:"id"`
+}
+
+func NewSender(ps *session.PduSessions, tunMan *tun.TunManager) *Sender {
+	return &Sender{
+		ps:       ps,
+		tunMan:   tunMan,
+		sessions: make(map[uint32]*testSession),
+		nextId:   1,
+	}
+}
+
+func (s *Sender) Register(e *gin.Engine) {
+	e.GET("/twamp", s.Status)
+	e.POST("/twamp/start", s.StartTestSession)
+	e.POST("/twamp/stop", s.StopTestSession)
+}
+
+func (s *Sender) Start(ctx context.Context) error {
+	s.InitContext(ctx)
+	return nil
+}
+
+// WaitShutdown waits for test sessions to be stopped
+func (s *Sender) WaitShutdown(ctx context.Context) error {
+	s.mu.Lock()
+	sessions := make([]*testSession, 0, len(s.sessions))
+	for _, ts := range s.sessions {
+		sessions = append(sessions, ts)
+	}
+	s.mu.Unlock()
+	for _, ts := range sessions {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ts.done:
+		}
+	}
+	return nil
+}
+
+// Status returns the status of all test sessions
+func (s *Sender) Status(c *gin.Context) {
+	s.mu.Lock()
+	sessions := make([]TestSessionStatus, 0, len(s.sessions))
+	for _, ts := range s.sessions {
+		sessions = append(sessions, ts.status())
+	}
+	s.mu.Unlock()
+	slices.SortFunc(sessions, func(a, b TestSessionStatus) int { return cmp.Compare(a.Id, b.Id) })
+
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, sessions)
+}
+
+// StartTestSession starts a test session over a PDU Session
+func (s *Sender) StartTestSession(c *gin.Context) {
+	var conf TestConfig
+	if err := c.BindJSON(&conf); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	conf = conf.withDefaults()
+	ueIp, _, err := s.ps.Lookup(conf.Dnn, conf.Addr)
+	if err != nil {
+		c.JSON(http.StatusNotFound, jsonapi.MessageWithError{Message: "could not start test session", Error: err})
+		return
+	}
+	target, err := conf.target()
+	if err == nil {
+		ueIp = s.ps.SourceAddr(ueIp, target.Addr())
+		err = conf.validate(ueIp, target)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not start test session", Error: err})
+		return
+	}
+	conn, err := s.tunMan.DialContext(s.Context(), "udp", ueIp, target)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"ue-ip-addr": ueIp,
+			"reflector":  target,
+		}).Error("Could not start test session")
+		c.JSON(http.StatusInternalServerError, jsonapi.MessageWithError{Message: "could not start test session", Error: err})
+		return
+	}
+
+	s.mu.Lock()
+	ts := newTestSession(s.nextId, ueIp, target, conf, conn)
+	s.nextId++
+	ctx, cancel := context.WithCancel(s.Context())
+	ts.cancel = cancel
+	s.sessions[ts.id] = ts
+	s.mu.Unlock()
+	go ts.run(ctx)
+	logrus.WithFields(logrus.Fields{
+		"test-session": ts.id,
+		"ue-ip-addr":   ueIp,
+		"reflector":    target,
+		"interval":     conf.Interval,
+	}).Info("TWAMP-Light test session started")
+	c.JSON(http.StatusCreated, ts.status())
+}
+
+// StopTestSession stops a test session; its status is kept
+func (s *Sender) StopTestSession(c *gin.Context) {
+	var msg TestSessionIdMsg
+	if err := c.BindJSON(&msg); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	s.mu.Lock()
+	ts, ok := s.sessions[msg.Id]
+	s.mu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, jsonapi.MessageWithError{Message: "could not stop test session", Error: ErrSessionNotFound})
+		return
+	}
+	ts.cancel()
+	logrus.WithFields(logrus.Fields{"test-session": ts.id}).Info("TWAMP-Light test session stopped")
+	c.JSON(http.StatusOK, ts.status())
+}
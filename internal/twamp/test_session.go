@@ -0,0 +1,208 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package twamp
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nextmn/ue-lite/internal/echo"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+type TestSessionStatus struct {
+	Id        uint32         `json:"id"`
+	UeIpAddr  netip.Addr     `json:"ue-ip-addr"`
+	Reflector netip.AddrPort `json:"reflector"`
+	Config    TestConfig     `json:"config"`
+	Running   bool           `json:"running"`
+	Start     time.Time      `json:"start"`
+
+	Sent       uint64 `json:"sent"`
+	Received   uint64 `json:"received"`
+	Lost       uint64 `json:"lost"`        // test packets not reflected before the timeout
+	SendErrors uint64 `json:"send-errors"` // test packets that could not be sent
+
+	RoundTrip echo.DelayStatus `json:"round-trip"` // processing time of the reflector excluded
+	Forward   echo.DelayStatus `json:"forward"`    // one-way, from the UE to the reflector (clocks must be synchronized)
+	Backward  echo.DelayStatus `json:"backward"`   // one-way, from the reflector to the UE (clocks must be synchronized)
+}
+
+// testSession sends test packets from a UE IP Address, and receives the packets of the reflector
+type testSession struct {
+	id      uint32
+	ueIp    netip.Addr
+	target  netip.AddrPort
+	conf    TestConfig
+	conn    net.Conn
+	start   time.Time
+	cancel  context.CancelFunc
+	closing atomic.Bool // the connection is being closed
+	done    chan struct{}
+
+	mu         sync.Mutex
+	pending    *echo.Pending // send times are relative to start
+	sent       uint64
+	received   uint64
+	sendErrors uint64
+	roundTrip  echo.DelayStats
+	forward    echo.DelayStats
+	backward   echo.DelayStats
+}
+
+func newTestSession(id uint32, ueIp netip.Addr, target netip.AddrPort, conf TestConfig, conn net.Conn) *testSession {
+	// test packets are sent with a TTL of 255 (RFC 5357, section 4.1.2); not available with the userspace network stack
+	var err error
+	if ueIp.Is4() {
+		err = ipv4.NewConn(conn).SetTTL(TEST_TTL)
+	} else {
+		err = ipv6.NewConn(conn).SetHopLimit(TEST_TTL)
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"test-session": id}).Debug("Could not set TTL of test packets")
+	}
+	return &testSession{
+		id:      id,
+		ueIp:    ueIp,
+		target:  target,
+		conf:    conf,
+		conn:    conn,
+		start:   time.Now(),
+		done:    make(chan struct{}),
+		pending: echo.NewPending(),
+	}
+}
+
+// run sends test packets until ctx is done (or the count or duration of the session is reached), then waits for the last ones
+func (s *testSession) run(ctx context.Context) {
+	defer close(s.done)
+	if s.conf.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(s.conf.Duration))
+		defer cancel()
+	}
+	go s.receive()
+	go echo.RunLossCheck(ctx, s.checkLoss)
+	s.send(ctx)
+
+	// wait for the last reflected packets
+	timer := time.NewTimer(time.Duration(s.conf.Timeout))
+	defer timer.Stop()
+	<-timer.C
+	s.closing.Store(true)
+	s.conn.Close()
+	s.mu.Lock()
+	s.pending.ExpireAll()
+	s.mu.Unlock()
+}
+
+// send sends test packets until ctx is done, or the count of the session is reached
+func (s *testSession) send(ctx context.Context) {
+	buf := make([]byte, s.conf.Size)
+	ticker := time.NewTicker(time.Duration(s.conf.Interval))
+	defer ticker.Stop()
+	for i := uint64(0); s.conf.Count == 0 || i < s.conf.Count; i++ {
+		seq := uint32(i) // wraps around when the count is not set
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+		now := time.Now()
+		senderPacket{seq: seq, timestamp: now}.encode(buf)
+		// registered before sending, so a fast answer is not ignored
+		s.mu.Lock()
+		s.pending.Add(uint64(seq), now.Sub(s.start))
+		s.mu.Unlock()
+		if _, err := s.conn.Write(buf); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"test-session": s.id}).Trace("Could not send test packet")
+			s.mu.Lock()
+			s.pending.Remove(uint64(seq))
+			s.sendErrors++
+			s.mu.Unlock()
+			continue
+		}
+		s.mu.Lock()
+		s.sent++
+		s.mu.Unlock()
+	}
+}
+
+// receive reads packets of the reflector until the connection is closed
+func (s *testSession) receive() {
+	buf := make([]byte, RECEIVE_MAX)
+	for {
+		n, err := s.conn.Read(buf)
+		if err != nil {
+			if s.closing.Load() {
+				return
+			}
+			// e.g. ICMP errors reported on the socket
+			continue
+		}
+		now := time.Now()
+		p, err := decodeReflectorPacket(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.mu.Lock()
+		if sent, ok := s.pending.Remove(uint64(p.senderSeq)); ok {
+			s.received++
+			s.roundTrip.Add(now.Sub(s.start) - sent - p.timestamp.Sub(p.receiveTime))
+			s.forward.Add(p.receiveTime.Sub(s.start.Add(sent)))
+			s.backward.Add(now.Sub(p.timestamp))
+		}
+		s.mu.Unlock()
+	}
+}
+
+// isClosed returns true when the test session is done
+func (s *testSession) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkLoss counts test packets not reflected before the timeout as lost
+func (s *testSession) checkLoss() {
+	deadline := time.Since(s.start) - time.Duration(s.conf.Timeout)
+	s.mu.Lock()
+	s.pending.Expire(deadline)
+	s.mu.Unlock()
+}
+
+// status returns the status of the test session
+func (s *testSession) status() TestSessionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return TestSessionStatus{
+		Id:         s.id,
+		UeIpAddr:   s.ueIp,
+		Reflector:  s.target,
+		Config:     s.conf,
+		Running:    !s.isClosed(),
+		Start:      s.start,
+		Sent:       s.sent,
+		Received:   s.received,
+		Lost:       s.pending.Lost(),
+		SendErrors: s.sendErrors,
+		RoundTrip:  s.roundTrip.Status(),
+		Forward:    s.forward.Status(),
+		Backward:   s.backward.Status(),
+	}
+}
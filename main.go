@@ -7,6 +7,7 @@ package main
 
 import (
 	"context"
+	"net/netip"
 	"os"
 	"os/signal"
 	"runtime/debug"
@@ -17,7 +18,10 @@ import (
 	"github.com/nextmn/logrus-formatter/logger"
 
 	"github.com/nextmn/ue-lite/internal/app"
+	uecli "github.com/nextmn/ue-lite/internal/cli"
 	"github.com/nextmn/ue-lite/internal/config"
+	"github.com/nextmn/ue-lite/internal/doctor"
+	"github.com/nextmn/ue-lite/internal/twamp"
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v3"
@@ -57,11 +61,20 @@ func main() {
 			{
 				Name:  "run",
 				Usage: "Runs the UE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "netns",
+						Usage: "create the TUN interface in the network namespace `NAME` (created if it does not exist); radio and control interfaces stay in the current namespace",
+					},
+				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					conf, err := config.ParseConf(cmd.String("config"))
 					if err != nil {
 						logrus.WithContext(ctx).WithError(err).Fatal("Error loading config, exiting…")
 					}
+					if netns := cmd.String("netns"); netns != "" {
+						conf.Tun.Netns = netns
+					}
 					if conf.Logger != nil {
 						logrus.SetLevel(conf.Logger.Level)
 					}
@@ -89,6 +102,93 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:      "exec",
+				Usage:     "Executes a command in the network namespace of a PDU Session of the running UE (or on the host, bound to the UE IP Address, without netns), and prints its output",
+				ArgsUsage: "[--] COMMAND [ARGS…] (`{ue-ip-addr}` is replaced by the UE IP Address, also available in $UE_IP_ADDR)",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "dnn",
+						Usage: "use the PDU Session of this `DNN`",
+					},
+					&cli.StringFlag{
+						Name:  "address",
+						Usage: "use the PDU Session of this UE IP `ADDRESS` (instead of --dnn)",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					conf, err := config.ParseConf(cmd.String("config"))
+					if err != nil {
+						logrus.WithContext(ctx).WithError(err).Fatal("Error loading config, exiting…")
+					}
+					if conf.Logger != nil {
+						logrus.SetLevel(conf.Logger.Level)
+					}
+					msg := uecli.CliExecMsg{
+						Dnn:     cmd.String("dnn"),
+						Command: cmd.Args().Slice(),
+					}
+					if addr := cmd.String("address"); addr != "" {
+						if msg.Addr, err = netip.ParseAddr(addr); err != nil {
+							logrus.WithError(err).Fatal("Invalid UE IP Address")
+						}
+					}
+					code, err := uecli.Exec(ctx, conf.Control.Uri, msg, os.Stdout, "go-github-nextmn-ue-lite")
+					if err != nil {
+						logrus.WithError(err).Fatal("Could not execute command")
+					}
+					os.Exit(code)
+					return nil
+				},
+			},
+			{
+				Name:  "doctor",
+				Usage: "Checks the host is ready to run the UE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "netns",
+						Usage: "check the TUN interface can be created in the network namespace `NAME`, as with `run --netns`",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					conf, err := config.ParseConf(cmd.String("config"))
+					if err != nil {
+						logrus.WithContext(ctx).WithError(err).Fatal("Error loading config, exiting…")
+					}
+					if netns := cmd.String("netns"); netns != "" {
+						conf.Tun.Netns = netns
+					}
+					if conf.Logger != nil {
+						logrus.SetLevel(conf.Logger.Level)
+					}
+					if !doctor.NewDoctor(conf, "go-github-nextmn-ue-lite").Run(ctx, os.Stdout) {
+						os.Exit(1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "twamp-reflector",
+				Usage: "Runs a TWAMP-Light reflector, e.g. in the Data Network, for test sessions started with `POST /twamp/start`",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Usage: "listen for test packets on `ADDRESS`",
+						Value: "0.0.0.0:862",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					listen, err := netip.ParseAddrPort(cmd.String("listen"))
+					if err != nil {
+						logrus.WithError(err).Fatal("Invalid listen address")
+					}
+					r := twamp.NewReflector(listen)
+					if err := r.Start(ctx); err != nil {
+						logrus.WithError(err).Fatal("Could not start TWAMP-Light reflector")
+					}
+					return r.WaitShutdown(context.WithoutCancel(ctx))
+				},
+			},
 		},
 	}
 	if err := app.Run(ctx, os.Args); err != nil {